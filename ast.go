@@ -2,25 +2,124 @@ package pock
 
 type Expr interface{}
 
+type ConditionalExpr struct {
+	Cond Expr
+	Then Expr
+	Else Expr
+	Span Span
+}
+
 type BinaryExpr struct {
 	Op    TokenType
 	Left  Expr
 	Right Expr
+	Span  Span
 }
 
 type UnaryExpr struct {
 	Op   TokenType
 	Expr Expr
+	Span Span
 }
 
 type GroupExpr struct {
 	Expr Expr
+	Span Span
 }
 
 type GetExpr struct {
 	Names []string
+	Span  Span
+}
+
+// IndexExpr accesses an element of a list by index, or the value of a map by
+// key. Member access following an index, call or group, as in `a[0].b`, is
+// parsed as an IndexExpr with a string literal index. Optional is set for
+// null-safe access with `?.`, which yields null when the target is null or
+// missing, or does not hold the index, and then skips the accesses that have the
+// IndexExpr as their target.
+type IndexExpr struct {
+	Target   Expr
+	Index    Expr
+	Optional bool
+	Span     Span
+}
+
+type CallExpr struct {
+	Name string
+	Args []Expr
+	Span Span
+}
+
+type ListExpr struct {
+	Elements []Expr
+	Span     Span
+}
+
+type MapExpr struct {
+	Entries []MapEntry
+	Span    Span
+}
+
+type MapEntry struct {
+	Key   string
+	Value Expr
 }
 
 type LiteralExpr struct {
 	Token Token
 }
+
+// SpanOf returns the range of source covered by expr.
+func SpanOf(expr Expr) Span {
+	switch expr := expr.(type) {
+	case ConditionalExpr:
+		return expr.Span
+	case BinaryExpr:
+		return expr.Span
+	case UnaryExpr:
+		return expr.Span
+	case GroupExpr:
+		return expr.Span
+	case GetExpr:
+		return expr.Span
+	case IndexExpr:
+		return expr.Span
+	case CallExpr:
+		return expr.Span
+	case ListExpr:
+		return expr.Span
+	case MapExpr:
+		return expr.Span
+	case LiteralExpr:
+		return expr.Token.Span
+	}
+	panic("invalid expression")
+}
+
+// children returns the sub-expressions of expr.
+func children(expr Expr) []Expr {
+	switch expr := expr.(type) {
+	case ConditionalExpr:
+		return []Expr{expr.Cond, expr.Then, expr.Else}
+	case BinaryExpr:
+		return []Expr{expr.Left, expr.Right}
+	case UnaryExpr:
+		return []Expr{expr.Expr}
+	case GroupExpr:
+		return []Expr{expr.Expr}
+	case IndexExpr:
+		return []Expr{expr.Target, expr.Index}
+	case CallExpr:
+		return expr.Args
+	case ListExpr:
+		return expr.Elements
+	case MapExpr:
+		values := make([]Expr, len(expr.Entries))
+		for i, entry := range expr.Entries {
+			values[i] = entry.Value
+		}
+		return values
+	}
+	return nil
+}
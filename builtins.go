@@ -0,0 +1,219 @@
+package pock
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// builtins are the functions registered in every new Interpreter.
+var builtins = map[string]function{
+	"abs":        {fn: builtinAbs, minArgs: 1, maxArgs: 1, builtin: true},
+	"min":        {fn: builtinMin, minArgs: 1, maxArgs: -1, builtin: true},
+	"max":        {fn: builtinMax, minArgs: 1, maxArgs: -1, builtin: true},
+	"floor":      {fn: builtinFloor, minArgs: 1, maxArgs: 1, builtin: true},
+	"ceil":       {fn: builtinCeil, minArgs: 1, maxArgs: 1, builtin: true},
+	"round":      {fn: builtinRound, minArgs: 1, maxArgs: 2, builtin: true},
+	"len":        {fn: builtinLen, minArgs: 1, maxArgs: 1, builtin: true},
+	"upper":      {fn: builtinUpper, minArgs: 1, maxArgs: 1, builtin: true},
+	"lower":      {fn: builtinLower, minArgs: 1, maxArgs: 1, builtin: true},
+	"contains":   {fn: builtinContains, minArgs: 2, maxArgs: 2, builtin: true},
+	"startsWith": {fn: builtinStartsWith, minArgs: 2, maxArgs: 2, builtin: true},
+}
+
+func builtinAbs(args []Value) (Value, error) {
+	switch v := args[0].(type) {
+	case IntValue:
+		if v == math.MinInt64 {
+			return nil, &RuntimeError{
+				Kind:     IntegerOverflow,
+				Msg:      "integer overflow in `abs`",
+				Operands: operandTypes(args),
+			}
+		}
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case DecimalValue:
+		return DecimalValue(math.Abs(float64(v))), nil
+	}
+	return nil, argumentError("abs", "integer or decimal", args...)
+}
+
+func builtinMin(args []Value) (Value, error) {
+	return extremum("min", args, func(a, b float64) bool { return a < b })
+}
+
+func builtinMax(args []Value) (Value, error) {
+	return extremum("max", args, func(a, b float64) bool { return a > b })
+}
+
+// extremum returns the argument for which better returns true against every
+// other argument, keeping the first one in case of ties.
+func extremum(name string, args []Value, better func(a, b float64) bool) (Value, error) {
+	var best Value
+	var bestNum float64
+	for _, arg := range args {
+		num, ok := toFloat(arg)
+		if !ok {
+			return nil, argumentError(name, "integer or decimal", args...)
+		}
+		if best == nil || better(num, bestNum) {
+			best = arg
+			bestNum = num
+		}
+	}
+	return best, nil
+}
+
+func builtinFloor(args []Value) (Value, error) {
+	switch v := args[0].(type) {
+	case IntValue:
+		return v, nil
+	case DecimalValue:
+		return DecimalValue(math.Floor(float64(v))), nil
+	}
+	return nil, argumentError("floor", "integer or decimal", args...)
+}
+
+func builtinCeil(args []Value) (Value, error) {
+	switch v := args[0].(type) {
+	case IntValue:
+		return v, nil
+	case DecimalValue:
+		return DecimalValue(math.Ceil(float64(v))), nil
+	}
+	return nil, argumentError("ceil", "integer or decimal", args...)
+}
+
+// builtinRound rounds half away from zero to the given number of decimal
+// places, which defaults to 0 and may be negative.
+func builtinRound(args []Value) (Value, error) {
+	digits := IntValue(0)
+	if len(args) == 2 {
+		var ok bool
+		if digits, ok = args[1].(IntValue); !ok {
+			return nil, &RuntimeError{
+				Kind:     TypeMismatch,
+				Msg:      "`round` digits must be integer",
+				Operands: operandTypes(args),
+			}
+		}
+	}
+
+	switch v := args[0].(type) {
+	case IntValue:
+		if digits >= 0 {
+			return v, nil
+		}
+		r, ok := roundInt(int64(v), int64(digits))
+		if !ok {
+			return nil, &RuntimeError{
+				Kind:     IntegerOverflow,
+				Msg:      "integer overflow in `round`",
+				Operands: operandTypes(args),
+			}
+		}
+		return IntValue(r), nil
+	case DecimalValue:
+		return DecimalValue(roundTo(float64(v), int(digits))), nil
+	}
+	return nil, argumentError("round", "integer or decimal", args...)
+}
+
+// roundInt rounds x to a multiple of 10^-digits, half away from zero, for a
+// negative digits. It returns false if the result overflows.
+func roundInt(x, digits int64) (int64, bool) {
+	if digits < -18 {
+		// 10^19 does not fit in an int64: x rounds to 0, or overflows to
+		// ±10^19.
+		return 0, digits < -19 || (x < 5e18 && x > -5e18)
+	}
+	scale := int64(1)
+	for range -digits {
+		scale *= 10
+	}
+	q, r := x/scale, x%scale
+	switch {
+	case 2*r >= scale:
+		q++
+	case 2*r <= -scale:
+		q--
+	}
+	return mulInt(q, scale)
+}
+
+func roundTo(x float64, digits int) float64 {
+	scale := math.Pow(10, float64(digits))
+	switch {
+	case scale == 0:
+		// The power of ten to round to is larger than any float64.
+		return math.Copysign(0, x)
+	case math.IsInf(scale, 0), math.IsInf(x*scale, 0):
+		// x has no digits below the power of ten to round to.
+		return x
+	}
+	return math.Round(x*scale) / scale
+}
+
+func builtinLen(args []Value) (Value, error) {
+	switch v := args[0].(type) {
+	case StringValue:
+		return IntValue(utf8.RuneCountInString(string(v))), nil
+	case ListValue:
+		return IntValue(len(v)), nil
+	case MapValue:
+		return IntValue(len(v)), nil
+	}
+	return nil, argumentError("len", "string, list or map", args...)
+}
+
+func builtinUpper(args []Value) (Value, error) {
+	if v, ok := args[0].(StringValue); ok {
+		return StringValue(strings.ToUpper(string(v))), nil
+	}
+	return nil, argumentError("upper", "string", args...)
+}
+
+func builtinLower(args []Value) (Value, error) {
+	if v, ok := args[0].(StringValue); ok {
+		return StringValue(strings.ToLower(string(v))), nil
+	}
+	return nil, argumentError("lower", "string", args...)
+}
+
+func builtinContains(args []Value) (Value, error) {
+	if s, sub, ok := checkBinary[StringValue, StringValue](args[0], args[1]); ok {
+		return BoolValue(strings.Contains(string(s), string(sub))), nil
+	}
+	return nil, argumentError("contains", "string", args...)
+}
+
+func builtinStartsWith(args []Value) (Value, error) {
+	if s, prefix, ok := checkBinary[StringValue, StringValue](args[0], args[1]); ok {
+		return BoolValue(strings.HasPrefix(string(s), string(prefix))), nil
+	}
+	return nil, argumentError("startsWith", "string", args...)
+}
+
+func toFloat(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case IntValue:
+		return float64(v), true
+	case DecimalValue:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// argumentError reports arguments of the wrong type. The interpreter fills in
+// the span of the call.
+func argumentError(name, expected string, args ...Value) *RuntimeError {
+	return &RuntimeError{
+		Kind:     TypeMismatch,
+		Msg:      fmt.Sprintf("`%s` arguments must be %s", name, expected),
+		Operands: operandTypes(args),
+	}
+}
@@ -0,0 +1,107 @@
+package pock
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltins(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected any
+	}
+	cases := []testCase{
+		{input: "abs(-3)", expected: 3},
+		{input: "abs(3)", expected: 3},
+		{input: "abs(-3.5)", expected: 3.5},
+		{input: "min(3)", expected: 3},
+		{input: "min(3, 1, 2)", expected: 1},
+		{input: "min(3, 1.5, 2)", expected: 1.5},
+		{input: "max(3, 1, 2)", expected: 3},
+		{input: "max(3, 4.5)", expected: 4.5},
+		{input: "floor(3)", expected: 3},
+		{input: "floor(3.7)", expected: 3.0},
+		{input: "floor(-3.2)", expected: -4.0},
+		{input: "ceil(3)", expected: 3},
+		{input: "ceil(3.2)", expected: 4.0},
+		{input: "ceil(-3.7)", expected: -3.0},
+		{input: "round(3.5)", expected: 4.0},
+		{input: "round(-3.5)", expected: -4.0},
+		{input: "round(3.14159, 2)", expected: 3.14},
+		{input: "round(1138, 2)", expected: 1138},
+		{input: "round(1138, -2)", expected: 1100},
+		{input: "round(1138.0, -1)", expected: 1140.0},
+		{input: "round(1.5, 400)", expected: 1.5},
+		{input: "round(0.0, 400)", expected: 0.0},
+		{input: "round(1e300, 10)", expected: 1e300},
+		{input: "round(1.5, -400)", expected: 0.0},
+		{input: "round(1138, -400)", expected: 0},
+		{input: "round(1150, -2)", expected: 1200},
+		{input: "round(-1150, -2)", expected: -1200},
+		{input: "round(-1149, -2)", expected: -1100},
+		{input: "round(9223372036854775807, -18)", expected: int64(9e18)},
+		{input: "round(4999999999999999999, -19)", expected: 0},
+		{input: `len("")`, expected: 0},
+		{input: `len("hello")`, expected: 5},
+		{input: `len("héllo")`, expected: 5},
+		{input: `upper("héllo")`, expected: "HÉLLO"},
+		{input: `lower("HeLLo")`, expected: "hello"},
+		{input: `contains("hello world", "o w")`, expected: true},
+		{input: `contains("hello world", "ow")`, expected: false},
+		{input: `startsWith("hello world", "hello")`, expected: true},
+		{input: `startsWith("hello world", "world")`, expected: false},
+		{input: "max(abs(-10), min(20, 30)) + 1", expected: 21},
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			val, err := NewInterpreter().Evaluate(expr)
+			require.NoError(t, err)
+			require.EqualValues(t, c.expected, val)
+		})
+	}
+}
+
+func TestBuiltinsError(t *testing.T) {
+	cases := []string{
+		"abs()",
+		`abs("hello")`,
+		"abs(-9223372036854775807 - 1)",
+		"min()",
+		`max(1, "hello")`,
+		"floor(true)",
+		"ceil(null)",
+		"round(1.5, 2.0)",
+		"round(1.5, 2, 3)",
+		"round(9223372036854775807, -1)",
+		"round(9223372036854775807, -19)",
+		"round(-9223372036854775807 - 1, -1)",
+		"len(12)",
+		"upper(12)",
+		"lower(true)",
+		`contains("hello")`,
+		`contains("hello", 1)`,
+		`startsWith(1, "hello")`,
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			_, err = NewInterpreter().Evaluate(expr)
+			require.Error(t, err)
+			snaps.MatchSnapshot(t, err)
+		})
+	}
+}
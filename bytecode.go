@@ -0,0 +1,330 @@
+package pock
+
+import (
+	"fmt"
+	"strings"
+)
+
+// opcode is an instruction of the VM. Instructions pop their operands from the
+// stack and push their result onto it.
+type opcode uint8
+
+const (
+	// Push constants[arg]
+	opConst opcode = iota
+
+	// Push the value of the variable in slots[arg]
+	opLoad
+
+	// Pop right and left, and push the result of the binary operator arg
+	opBinary
+
+	// Pop a value, and push the result of the unary operator arg
+	opUnary
+
+	// Pop index and target, and push target[index]. arg is 1 for null-safe
+	// access.
+	opIndex
+
+	// Pop the arguments and push the result of calls[arg]
+	opCall
+
+	// Pop arg values, and push a list of them
+	opList
+
+	// Pop a value for each of keys[arg], and push a map of them
+	opMap
+
+	// Jump to arg
+	opJump
+
+	// Pop a condition, and jump to arg if it is false
+	opJumpIfFalse
+
+	// Pop the left operand of `&&` or `||`, and jump to arg after pushing it
+	// back if it determines the result
+	opShortCircuit
+
+	// Check that the right operand of the logical operator arg is boolean
+	opCheckBool
+
+	// Jump to arg if the value on the stack is not null, or else pop it
+	opJumpIfNotNull
+
+	// Jump to arg if the value on the stack is null, leaving it there
+	opJumpIfNull
+
+	// Catch the errors reporting missing values of guards[arg].expr until the
+	// matching opEndTry, and jump to guards[arg].target on such an error
+	opTry
+
+	// End the innermost opTry
+	opEndTry
+)
+
+type instruction struct {
+	op  opcode
+	arg int32
+}
+
+// bytecode is an expression compiled for the VM. Variables are resolved to
+// slots at compile time, and functions are resolved to call sites, so that
+// running the bytecode does not need to walk the expression.
+type bytecode struct {
+	code []instruction
+
+	// spans[pc] is the span of the expression compiled to code[pc], which
+	// locates the errors of the instruction.
+	spans []Span
+
+	constants []Value
+	slots     [][]string
+	calls     []callSite
+	keys      [][]string
+	guards    []guard
+
+	// maxStack is the maximum depth of the stack when running the code.
+	maxStack int
+}
+
+type callSite struct {
+	name  string
+	fn    function
+	found bool
+	argc  int
+}
+
+// guard is the left operand of a `??` operator, whose missing values evaluate
+// the right operand at target instead, or the target of a `?.`, whose missing
+// values push null at target instead.
+type guard struct {
+	expr   Expr
+	target int
+}
+
+type compiler struct {
+	b         *bytecode
+	functions map[string]function
+	slotOf    map[string]int
+	depth     int
+}
+
+// compileBytecode compiles expr, resolving calls to functions.
+func compileBytecode(expr Expr, functions map[string]function) *bytecode {
+	c := compiler{b: &bytecode{}, functions: functions, slotOf: map[string]int{}}
+	c.compile(expr)
+	return c.b
+}
+
+// emit appends an instruction popping pop values and pushing push values, and
+// returns its position.
+func (c *compiler) emit(op opcode, arg int, span Span, pop, push int) int {
+	c.b.code = append(c.b.code, instruction{op: op, arg: int32(arg)})
+	c.b.spans = append(c.b.spans, span)
+	c.depth += push - pop
+	c.b.maxStack = max(c.b.maxStack, c.depth)
+	return len(c.b.code) - 1
+}
+
+// patch makes the jump at pc jump to the next instruction.
+func (c *compiler) patch(pc int) {
+	c.b.code[pc].arg = int32(len(c.b.code))
+}
+
+func (c *compiler) compile(expr Expr) {
+	switch expr := expr.(type) {
+	case ConditionalExpr:
+		c.compileConditional(expr)
+	case BinaryExpr:
+		c.compileBinary(expr)
+	case UnaryExpr:
+		c.compile(expr.Expr)
+		c.emit(opUnary, int(expr.Op), expr.Span, 1, 1)
+	case GroupExpr:
+		c.compile(expr.Expr)
+	case GetExpr:
+		c.compileGet(expr)
+	case IndexExpr:
+		c.compileIndex(expr)
+	case CallExpr:
+		c.compileCall(expr)
+	case ListExpr:
+		for _, element := range expr.Elements {
+			c.compile(element)
+		}
+		c.emit(opList, len(expr.Elements), expr.Span, len(expr.Elements), 1)
+	case MapExpr:
+		keys := make([]string, len(expr.Entries))
+		for i, entry := range expr.Entries {
+			c.compile(entry.Value)
+			keys[i] = entry.Key
+		}
+		c.b.keys = append(c.b.keys, keys)
+		c.emit(opMap, len(c.b.keys)-1, expr.Span, len(keys), 1)
+	case LiteralExpr:
+		c.compileLiteral(expr)
+	default:
+		panic("invalid expression")
+	}
+}
+
+func (c *compiler) compileConditional(expr ConditionalExpr) {
+	c.compile(expr.Cond)
+	jumpElse := c.emit(opJumpIfFalse, 0, expr.Span, 1, 0)
+	c.compile(expr.Then)
+	jumpEnd := c.emit(opJump, 0, expr.Span, 0, 0)
+	// Only one branch pushes its value.
+	c.depth--
+	c.patch(jumpElse)
+	c.compile(expr.Else)
+	c.patch(jumpEnd)
+}
+
+func (c *compiler) compileBinary(expr BinaryExpr) {
+	switch expr.Op {
+	case Or, And:
+		c.compile(expr.Left)
+		jump := c.emit(opShortCircuit, 0, expr.Span, 1, 0)
+		c.compile(expr.Right)
+		c.emit(opCheckBool, int(expr.Op), expr.Span, 1, 1)
+		c.patch(jump)
+	case QuestionQuestion:
+		c.b.guards = append(c.b.guards, guard{expr: expr.Left})
+		g := len(c.b.guards) - 1
+		c.emit(opTry, g, expr.Span, 0, 0)
+		c.compile(expr.Left)
+		c.emit(opEndTry, 0, expr.Span, 0, 0)
+		jump := c.emit(opJumpIfNotNull, 0, expr.Span, 1, 0)
+		c.b.guards[g].target = len(c.b.code)
+		c.compile(expr.Right)
+		c.patch(jump)
+	default:
+		c.compile(expr.Left)
+		c.compile(expr.Right)
+		c.emit(opBinary, int(expr.Op), expr.Span, 2, 1)
+	}
+}
+
+func (c *compiler) compileIndex(expr IndexExpr) {
+	for _, pc := range c.compileChain(expr, true) {
+		c.patch(pc)
+	}
+}
+
+// compileChain compiles expr as a link of a chain of postfix operators, as in
+// `a?.b.c[0]`, and returns the jumps to the end of the chain taken when a `?.`
+// along it yields null. last is set for the last link of the chain, after which
+// there is nothing left to skip.
+func (c *compiler) compileChain(expr IndexExpr, last bool) []int {
+	if !expr.Optional {
+		skips := c.compileLink(expr.Target)
+		c.compile(expr.Index)
+		c.emit(opIndex, 0, expr.Span, 2, 1)
+		return skips
+	}
+
+	// A missing target is null to `?.`, as the left operand of `??` is
+	// replaced with the right operand.
+	c.b.guards = append(c.b.guards, guard{expr: expr.Target})
+	g := len(c.b.guards) - 1
+	c.emit(opTry, g, expr.Span, 0, 0)
+	skips := c.compileLink(expr.Target)
+	c.emit(opEndTry, 0, expr.Span, 0, 0)
+	c.compile(expr.Index)
+	c.emit(opIndex, 1, expr.Span, 2, 1)
+	jumps := []int{c.emit(opJump, 0, expr.Span, 0, 0)}
+	// Only one of the index and null is pushed.
+	c.depth--
+	if len(skips) > 0 {
+		// The target skipped the rest of its chain with null on the stack,
+		// which is the result of `?.` once the opTry is ended.
+		for _, pc := range skips {
+			c.patch(pc)
+		}
+		c.depth++
+		c.emit(opEndTry, 0, expr.Span, 0, 0)
+		jumps = append(jumps, c.emit(opJump, 0, expr.Span, 0, 0))
+		c.depth--
+	}
+	c.b.guards[g].target = len(c.b.code)
+	c.b.constants = append(c.b.constants, null)
+	c.emit(opConst, len(c.b.constants)-1, expr.Span, 0, 1)
+	for _, pc := range jumps {
+		c.patch(pc)
+	}
+	if last {
+		return nil
+	}
+	return []int{c.emit(opJumpIfNull, 0, expr.Span, 0, 0)}
+}
+
+// compileLink compiles the target of an index expression, continuing the chain
+// of postfix operators if the target is an index expression too.
+func (c *compiler) compileLink(expr Expr) []int {
+	if link, ok := expr.(IndexExpr); ok {
+		return c.compileChain(link, false)
+	}
+	c.compile(expr)
+	return nil
+}
+
+func (c *compiler) compileGet(expr GetExpr) {
+	if len(expr.Names) == 0 {
+		panic("empty get expression")
+	}
+	path := strings.Join(expr.Names, ".")
+	slot, ok := c.slotOf[path]
+	if !ok {
+		c.b.slots = append(c.b.slots, expr.Names)
+		slot = len(c.b.slots) - 1
+		c.slotOf[path] = slot
+	}
+	c.emit(opLoad, slot, expr.Span, 0, 1)
+}
+
+func (c *compiler) compileCall(expr CallExpr) {
+	f, found := c.functions[expr.Name]
+	c.b.calls = append(c.b.calls, callSite{
+		name:  expr.Name,
+		fn:    f,
+		found: found,
+		argc:  len(expr.Args),
+	})
+	// Calls to unknown functions fail before evaluating their arguments.
+	argc := 0
+	if found {
+		argc = len(expr.Args)
+		for _, arg := range expr.Args {
+			c.compile(arg)
+		}
+	}
+	c.emit(opCall, len(c.b.calls)-1, expr.Span, argc, 1)
+}
+
+func (c *compiler) compileLiteral(expr LiteralExpr) {
+	var val Value
+	switch expr.Token.Type {
+	case True:
+		val = BoolValue(true)
+	case False:
+		val = BoolValue(false)
+	case Null:
+		val = null
+	case Integer:
+		val = IntValue(expr.Token.IntegerValue)
+	case Decimal:
+		val = DecimalValue(expr.Token.DecimalValue)
+	case String:
+		val = StringValue(expr.Token.StringValue)
+	default:
+		panic(
+			fmt.Sprintf(
+				"invalid literal expression: Token{%s, %s}",
+				expr.Token.Type,
+				expr.Token.Lexeme,
+			),
+		)
+	}
+	c.b.constants = append(c.b.constants, val)
+	c.emit(opConst, len(c.b.constants)-1, expr.Token.Span, 0, 1)
+}
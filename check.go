@@ -0,0 +1,625 @@
+package pock
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Diagnostic is an error found by Check. Kind is the kind of the RuntimeError
+// the expression would fail with when evaluated.
+type Diagnostic struct {
+	Kind RuntimeErrorKind
+	Span Span
+	Msg  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Span, d.Msg)
+}
+
+// Check infers the type of expr from the types of the variables declared in
+// schema, without evaluating expr. It reports every operation that would fail
+// for some of the values allowed by the schema, in the order they appear in
+// the source. Expressions whose type cannot be known have type AnyType, and
+// expressions that have an error have type InvalidType; neither causes
+// further errors.
+//
+// Check assumes that lists are indexed within their bounds, that integer
+// arithmetic does not overflow and that no division by zero occurs. Where
+// integers and decimals mix, as in `c ? 1 : 0.5`, the result has type
+// DecimalType, although it may be an integer at runtime. Only the builtin
+// functions are known to Check; use Interpreter.Check to check calls to
+// functions registered with RegisterFunc.
+func Check(expr Expr, schema Schema) (Type, []Diagnostic) {
+	return check(expr, schema, builtins)
+}
+
+// check is like Check, with the functions that can be called. Functions that
+// are not builtins have type AnyType.
+func check(expr Expr, schema Schema, functions map[string]function) (Type, []Diagnostic) {
+	root, _ := schema.root()
+	c := checker{root: root, functions: functions}
+	t := c.check(expr)
+	slices.SortStableFunc(c.diags, func(a, b Diagnostic) int {
+		return a.Span.Start.Offset - b.Span.Start.Offset
+	})
+	return t, c.diags
+}
+
+type checker struct {
+	root      Type
+	functions map[string]function
+	diags     []Diagnostic
+}
+
+var anyType = Type{Kind: AnyType}
+
+var invalidType = Type{Kind: InvalidType}
+
+func (c *checker) errorf(kind RuntimeErrorKind, span Span, format string, args ...any) Type {
+	c.diags = append(c.diags, Diagnostic{Kind: kind, Span: span, Msg: fmt.Sprintf(format, args...)})
+	return invalidType
+}
+
+// invalid reports whether any of types is InvalidType.
+func invalid(types ...Type) bool {
+	for _, t := range types {
+		if t.Kind == InvalidType {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) check(expr Expr) Type {
+	switch expr := expr.(type) {
+	case ConditionalExpr:
+		return c.checkConditional(expr)
+	case BinaryExpr:
+		return c.checkBinary(expr)
+	case UnaryExpr:
+		return c.checkUnary(expr)
+	case GroupExpr:
+		return c.check(expr.Expr)
+	case GetExpr:
+		return c.checkGet(expr)
+	case IndexExpr:
+		return c.checkIndex(expr)
+	case CallExpr:
+		return c.checkCall(expr)
+	case ListExpr:
+		return c.checkList(expr)
+	case MapExpr:
+		return c.checkMap(expr)
+	case LiteralExpr:
+		return c.checkLiteral(expr)
+	}
+	panic("invalid expression")
+}
+
+func (c *checker) checkConditional(expr ConditionalExpr) Type {
+	cond := c.check(expr.Cond)
+	then := c.check(expr.Then)
+	els := c.check(expr.Else)
+	if !invalid(cond) && !allows(cond, func(t Type) bool { return t.Kind == BooleanType }) {
+		c.errorf(TypeMismatch, expr.Span, "`?:` condition must be boolean, got %s", cond)
+	}
+	return joinTypes(then, els)
+}
+
+// allows reports whether every alternative of t is AnyType or satisfies ok.
+func allows(t Type, ok func(Type) bool) bool {
+	for _, alt := range t.alternatives() {
+		if alt.Kind != AnyType && !ok(alt) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *checker) checkBinary(expr BinaryExpr) Type {
+	switch expr.Op {
+	case Or, And:
+		left := c.check(expr.Left)
+		right := c.check(expr.Right)
+		isBool := func(t Type) bool { return t.Kind == BooleanType }
+		if invalid(left, right) {
+			return invalidType
+		}
+		if !allows(left, isBool) || !allows(right, isBool) {
+			c.errorf(
+				TypeMismatch,
+				expr.Span,
+				"`%s` operands must be boolean, got %s and %s",
+				operatorLexeme(expr.Op),
+				left,
+				right,
+			)
+		}
+		return Type{Kind: BooleanType}
+	case QuestionQuestion:
+		return c.checkCoalesce(expr)
+	}
+
+	left := c.check(expr.Left)
+	right := c.check(expr.Right)
+	if invalid(left, right) {
+		return invalidType
+	}
+	var result *Type
+	for _, l := range left.alternatives() {
+		for _, r := range right.alternatives() {
+			t, msg := binaryType(expr.Op, l, r)
+			if msg != "" {
+				return c.errorf(TypeMismatch, expr.Span, "%s", msg)
+			}
+			if result == nil {
+				result = &t
+			} else {
+				*result = joinTypes(*result, t)
+			}
+		}
+	}
+	return *result
+}
+
+// binaryType returns the type of the result of op on non-optional operands of
+// types left and right, or a message describing why the operation fails.
+func binaryType(op TokenType, left, right Type) (Type, string) {
+	lexeme := operatorLexeme(op)
+	boolean := Type{Kind: BooleanType}
+	switch op {
+	case Lt, Lte, Gt, Gte:
+		if left.Kind == AnyType || right.Kind == AnyType {
+			return boolean, ""
+		}
+		if (left.isNumber() && right.isNumber()) || (left.Kind == StringType && right.Kind == StringType) {
+			return boolean, ""
+		}
+		return anyType, numberOrStringMessage(lexeme, left, right)
+	case Eq, Neq:
+		if left.Kind == AnyType || right.Kind == AnyType {
+			return boolean, ""
+		}
+		if left.isNumber() && right.isNumber() {
+			return boolean, ""
+		}
+		switch left.Kind {
+		case BooleanType, StringType, NullType:
+			if left.Kind == right.Kind {
+				return boolean, ""
+			}
+		}
+		return anyType, fmt.Sprintf("`%s` operands mismatch: %s and %s", lexeme, left, right)
+	case In:
+		switch right.Kind {
+		case AnyType, ListType:
+			return boolean, ""
+		case MapType:
+			if left.Kind == AnyType || left.Kind == StringType {
+				return boolean, ""
+			}
+			return anyType, fmt.Sprintf("`in` map key must be string, got %s", left)
+		case StringType:
+			if left.Kind == AnyType || left.Kind == StringType {
+				return boolean, ""
+			}
+			return anyType, fmt.Sprintf("`in` substring must be string, got %s", left)
+		}
+		return anyType, fmt.Sprintf("`in` right operand must be list, map or string, got %s", right)
+	case Plus:
+		if left.Kind == StringType && right.Kind == StringType {
+			return left, ""
+		}
+		if (left.Kind == AnyType || left.Kind == StringType) && (right.Kind == AnyType || right.Kind == StringType) {
+			return anyType, ""
+		}
+		if t, ok := arithmeticType(left, right); ok {
+			return t, ""
+		}
+		return anyType, numberOrStringMessage(lexeme, left, right)
+	case Minus, Star, Slash, Percent:
+		if t, ok := arithmeticType(left, right); ok {
+			return t, ""
+		}
+		return anyType, fmt.Sprintf("`%s` operands must be integer or decimal, got %s and %s", lexeme, left, right)
+	case StarStar:
+		t, ok := arithmeticType(left, right)
+		if !ok {
+			return anyType, fmt.Sprintf("`**` operands must be integer or decimal, got %s and %s", left, right)
+		}
+		// An integer raised to a negative integer is a decimal.
+		if t.Kind == IntegerType {
+			return anyType, ""
+		}
+		return t, ""
+	}
+	panic(fmt.Sprintf("invalid binary operator: %s", op))
+}
+
+// arithmeticType returns the type of the result of an arithmetic operation on
+// numbers of types left and right.
+func arithmeticType(left, right Type) (Type, bool) {
+	switch {
+	case left.Kind == AnyType && (right.Kind == AnyType || right.isNumber()):
+		return anyType, true
+	case right.Kind == AnyType && left.isNumber():
+		return anyType, true
+	case left.Kind == IntegerType && right.Kind == IntegerType:
+		return left, true
+	case left.isNumber() && right.isNumber():
+		return Type{Kind: DecimalType}, true
+	}
+	return anyType, false
+}
+
+func numberOrStringMessage(lexeme string, left, right Type) string {
+	if (left.Kind == StringType) != (right.Kind == StringType) {
+		return fmt.Sprintf(
+			"`%s` cannot mix string and non-string operands: %s and %s",
+			lexeme,
+			left,
+			right,
+		)
+	}
+	return fmt.Sprintf("`%s` operands must be both numbers or both strings: %s and %s", lexeme, left, right)
+}
+
+// checkCoalesce checks `??`. Unknown variables and keys along the path of the
+// left operand, and values along the path that cannot be indexed, are not
+// errors, as `??` is meant to replace them.
+func (c *checker) checkCoalesce(expr BinaryExpr) Type {
+	left, missing := c.checkMissing(expr.Left)
+	right := c.check(expr.Right)
+	switch {
+	case missing && invalid(left), left.Kind == NullType:
+		return right
+	case missing, left.Kind == OptionalType:
+		// The left operand may be missing or null, or present.
+		return joinTypes(nonNull(left), right)
+	}
+	return left
+}
+
+// checkMissing checks expr, without reporting the unknown variables and keys
+// along its path, nor the values along its path that cannot be indexed. It
+// reports whether expr may be missing.
+func (c *checker) checkMissing(expr Expr) (Type, bool) {
+	diags := c.diags
+	c.diags = nil
+	t := c.check(expr)
+	missing := false
+	for _, d := range c.diags {
+		missingKind := d.Kind == UnknownVariable || d.Kind == UnknownKey || d.Kind == NotAMap
+		if missingKind && onPath(expr, d.Span) {
+			missing = true
+			continue
+		}
+		diags = append(diags, d)
+	}
+	c.diags = diags
+	return t, missing
+}
+
+func (c *checker) checkUnary(expr UnaryExpr) Type {
+	t := c.check(expr.Expr)
+	if invalid(t) {
+		return t
+	}
+	switch expr.Op {
+	case Not:
+		if !allows(t, func(t Type) bool { return t.Kind == BooleanType }) {
+			return c.errorf(TypeMismatch, expr.Span, "`!` operand must be boolean, got %s", t)
+		}
+		return Type{Kind: BooleanType}
+	case Minus:
+		if !allows(t, Type.isNumber) {
+			return c.errorf(TypeMismatch, expr.Span, "`-` operand must be integer or decimal, got %s", t)
+		}
+		return t
+	}
+	panic(fmt.Sprintf("invalid unary operator: %s", expr.Op))
+}
+
+// checkGet checks a variable path. A variable or key that may be missing, or a
+// map that may be null, is reported once, and the path is checked on as if it
+// were present, so that `??` can still use its type.
+func (c *checker) checkGet(expr GetExpr) Type {
+	t, ok := c.root.Fields[expr.Names[0]]
+	if !ok {
+		return c.errorf(UnknownVariable, expr.Span, "unknown variable '%s'", expr.Names[0])
+	}
+	reported := false
+	if t.Kind == MissingType {
+		c.errorf(UnknownVariable, expr.Span, "variable '%s' may be missing", expr.Names[0])
+		t, reported = t.elem(), true
+	}
+	for i, name := range expr.Names[1:] {
+		if t.Kind == OptionalType {
+			if !reported {
+				c.errorf(NotAMap, expr.Span, "%s may be null", pathString(expr.Names[:i+1]))
+			}
+			t, reported = t.elem(), true
+		}
+		switch {
+		case t.Kind == AnyType:
+			return t
+		case t.Kind == MapType && t.Fields == nil:
+			t = t.elem()
+		case t.Kind == MapType:
+			if t, ok = t.Fields[name]; !ok {
+				return c.errorf(UnknownKey, expr.Span, "unknown key '%s'", name)
+			}
+		default:
+			return c.errorf(NotAMap, expr.Span, "%s is not a map", pathString(expr.Names[:i+1]))
+		}
+		if t.Kind == MissingType {
+			if !reported {
+				c.errorf(UnknownKey, expr.Span, "key '%s' may be missing", name)
+			}
+			t, reported = t.elem(), true
+		}
+	}
+	return t
+}
+
+func pathString(names []string) string {
+	path := names[0]
+	for _, name := range names[1:] {
+		path += "." + name
+	}
+	return path
+}
+
+func (c *checker) checkIndex(expr IndexExpr) Type {
+	t, skipped := c.checkChain(expr)
+	if skipped {
+		return OptionalOf(t)
+	}
+	return t
+}
+
+// checkChain checks expr as a link of a chain of postfix operators, as in
+// `a?.b.c[0]`. It reports whether a `?.` along the chain may yield null and skip
+// the rest of the chain, in which case the type returned is that of the values
+// of the chain when it is not skipped.
+func (c *checker) checkChain(expr IndexExpr) (Type, bool) {
+	var target Type
+	skipped := false
+	if expr.Optional {
+		// A missing target is null to `?.`.
+		var missing bool
+		target, missing = c.checkMissing(expr.Target)
+		switch {
+		case missing && invalid(target):
+			target = Type{Kind: NullType}
+		case missing:
+			target = OptionalOf(target)
+		}
+	} else if link, ok := expr.Target.(IndexExpr); ok {
+		target, skipped = c.checkChain(link)
+		if skipped && target.Kind == NullType {
+			// The chain is always skipped.
+			c.check(expr.Index)
+			return target, true
+		}
+	} else {
+		target = c.check(expr.Target)
+	}
+	index := c.check(expr.Index)
+	if invalid(target, index) {
+		return invalidType, skipped
+	}
+
+	var key *string
+	if lit, ok := expr.Index.(LiteralExpr); ok && lit.Token.Type == String {
+		key = &lit.Token.StringValue
+	}
+
+	var result *Type
+	for _, alt := range target.alternatives() {
+		t, kind, msg := indexType(alt, index, key)
+		if msg != "" {
+			if expr.Optional {
+				t = Type{Kind: NullType}
+			} else {
+				return c.errorf(kind, expr.Span, "%s", msg), skipped
+			}
+		}
+		if t.Kind == MissingType {
+			if expr.Optional {
+				t = OptionalOf(t.elem())
+			} else {
+				switch {
+				case key != nil:
+					c.errorf(UnknownKey, expr.Span, "key '%s' may be missing", *key)
+				case alt.Kind == ListType:
+					c.errorf(IndexOutOfRange, expr.Span, "element may be missing")
+				default:
+					c.errorf(UnknownKey, expr.Span, "key may be missing")
+				}
+				t = t.elem()
+			}
+		}
+		if result == nil {
+			result = &t
+		} else {
+			*result = joinTypes(*result, t)
+		}
+	}
+	if expr.Optional {
+		// `?.` may yield null, skipping the rest of the chain.
+		return nonNull(*result), true
+	}
+	return *result, skipped
+}
+
+// indexType returns the type of the result of indexing a non-optional target
+// with index, or the kind and message of the error. key is the value of the
+// index if it is a string literal.
+func indexType(target, index Type, key *string) (Type, RuntimeErrorKind, string) {
+	switch target.Kind {
+	case AnyType:
+		return anyType, 0, ""
+	case ListType:
+		if index.Kind != AnyType && index.Kind != IntegerType {
+			return anyType, TypeMismatch, fmt.Sprintf("list index must be integer, got %s", index)
+		}
+		return target.elem(), 0, ""
+	case MapType:
+		if index.Kind != AnyType && index.Kind != StringType {
+			return anyType, TypeMismatch, fmt.Sprintf("map key must be string, got %s", index)
+		}
+		if target.Fields == nil {
+			return target.elem(), 0, ""
+		}
+		if key == nil {
+			return anyType, 0, ""
+		}
+		t, ok := target.Fields[*key]
+		if !ok {
+			return anyType, UnknownKey, fmt.Sprintf("unknown key '%s'", *key)
+		}
+		return t, 0, ""
+	}
+	if key != nil {
+		return anyType, NotAMap, fmt.Sprintf("cannot index %s with key '%s'", target, *key)
+	}
+	return anyType, NotAMap, fmt.Sprintf("cannot index %s with %s", target, index)
+}
+
+func (c *checker) checkCall(expr CallExpr) Type {
+	args := make([]Type, len(expr.Args))
+	for i, arg := range expr.Args {
+		args[i] = c.check(arg)
+	}
+
+	f, ok := c.functions[expr.Name]
+	if !ok {
+		return c.errorf(UnknownFunction, expr.Span, "unknown function '%s'", expr.Name)
+	}
+	if len(args) < f.minArgs || (f.maxArgs >= 0 && len(args) > f.maxArgs) {
+		return c.errorf(
+			ArityMismatch,
+			expr.Span,
+			"`%s` expects %s, got %d",
+			expr.Name,
+			arityString(f.minArgs, f.maxArgs),
+			len(args),
+		)
+	}
+
+	if invalid(args...) {
+		return invalidType
+	}
+	if !f.builtin {
+		return anyType
+	}
+	t, msg := builtinType(expr.Name, args)
+	if msg != "" {
+		return c.errorf(TypeMismatch, expr.Span, "%s", msg)
+	}
+	return t
+}
+
+// builtinType returns the type of the result of the builtin function name
+// called with arguments of types args, or a message describing why the call
+// fails.
+func builtinType(name string, args []Type) (Type, string) {
+	each := func(ok func(Type) bool) bool {
+		for _, arg := range args {
+			if !allows(arg, ok) {
+				return false
+			}
+		}
+		return true
+	}
+	isString := func(t Type) bool { return t.Kind == StringType }
+	expected := func(types string) string {
+		return fmt.Sprintf("`%s` arguments must be %s", name, types)
+	}
+
+	switch name {
+	case "abs", "floor", "ceil":
+		if !each(Type.isNumber) {
+			return anyType, expected("integer or decimal")
+		}
+		return args[0], ""
+	case "round":
+		if len(args) == 2 && !allows(args[1], func(t Type) bool { return t.Kind == IntegerType }) {
+			return anyType, "`round` digits must be integer"
+		}
+		if !allows(args[0], Type.isNumber) {
+			return anyType, expected("integer or decimal")
+		}
+		return args[0], ""
+	case "min", "max":
+		if !each(Type.isNumber) {
+			return anyType, expected("integer or decimal")
+		}
+		t := args[0]
+		for _, arg := range args[1:] {
+			t = joinTypes(t, arg)
+		}
+		return t, ""
+	case "len":
+		if !each(func(t Type) bool {
+			return t.Kind == StringType || t.Kind == ListType || t.Kind == MapType
+		}) {
+			return anyType, expected("string, list or map")
+		}
+		return Type{Kind: IntegerType}, ""
+	case "upper", "lower":
+		if !each(isString) {
+			return anyType, expected("string")
+		}
+		return Type{Kind: StringType}, ""
+	case "contains", "startsWith":
+		if !each(isString) {
+			return anyType, expected("string")
+		}
+		return Type{Kind: BooleanType}, ""
+	}
+	return anyType, ""
+}
+
+func (c *checker) checkList(expr ListExpr) Type {
+	if len(expr.Elements) == 0 {
+		return ListOf(anyType)
+	}
+	elem := c.check(expr.Elements[0])
+	for _, element := range expr.Elements[1:] {
+		elem = joinTypes(elem, c.check(element))
+	}
+	return ListOf(elem)
+}
+
+func (c *checker) checkMap(expr MapExpr) Type {
+	fields := make(map[string]Type, len(expr.Entries))
+	for _, entry := range expr.Entries {
+		fields[entry.Key] = c.check(entry.Value)
+	}
+	return MapOf(fields)
+}
+
+func (c *checker) checkLiteral(expr LiteralExpr) Type {
+	switch expr.Token.Type {
+	case True, False:
+		return Type{Kind: BooleanType}
+	case Null:
+		return Type{Kind: NullType}
+	case Integer:
+		return Type{Kind: IntegerType}
+	case Decimal:
+		return Type{Kind: DecimalType}
+	case String:
+		return Type{Kind: StringType}
+	}
+	panic(
+		fmt.Sprintf(
+			"invalid literal expression: Token{%s, %s}",
+			expr.Token.Type,
+			expr.Token.Lexeme,
+		),
+	)
+}
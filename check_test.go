@@ -0,0 +1,349 @@
+package pock
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchema = Schema{
+	"age":                  {Kind: IntegerType},
+	"score":                {Kind: DecimalType},
+	"name":                 {Kind: StringType},
+	"premium":              {Kind: BooleanType},
+	"nickname":             OptionalOf(Type{Kind: StringType}),
+	"alias":                MissingOf(Type{Kind: StringType}),
+	"tags":                 ListOf(Type{Kind: StringType}),
+	"scores":               DictOf(Type{Kind: DecimalType}),
+	"extra":                {Kind: AnyType},
+	"user.email":           {Kind: StringType},
+	"user.address.city":    {Kind: StringType},
+	"user.address.zip":     OptionalOf(Type{Kind: IntegerType}),
+	"user.manager":         OptionalOf(MapOf(map[string]Type{"name": {Kind: StringType}})),
+	"user.orders":          ListOf(MapOf(map[string]Type{"total": {Kind: DecimalType}})),
+	"user.address.country": {Kind: StringType},
+	"user.phone":           MissingOf(OptionalOf(Type{Kind: StringType})),
+	"sparse":               ListOf(MissingOf(Type{Kind: IntegerType})),
+	"partial":              DictOf(MissingOf(Type{Kind: IntegerType})),
+}
+
+func TestCheck(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected string
+	}
+	cases := []testCase{
+		{input: "1", expected: "integer"},
+		{input: "1.5", expected: "decimal"},
+		{input: `"hello"`, expected: "string"},
+		{input: "true", expected: "boolean"},
+		{input: "null", expected: "null"},
+		{input: "age", expected: "integer"},
+		{input: "age + 1", expected: "integer"},
+		{input: "age + 1.5", expected: "decimal"},
+		{input: "age / 2", expected: "integer"},
+		{input: "age ** 2", expected: "any"},
+		{input: "score ** 2", expected: "decimal"},
+		{input: "-score", expected: "decimal"},
+		{input: `name + "!"`, expected: "string"},
+		{input: "age >= 18 && premium", expected: "boolean"},
+		{input: "!premium || age < 18", expected: "boolean"},
+		{input: `name == "Ada"`, expected: "boolean"},
+		{input: "age == 1.0", expected: "boolean"},
+		{input: `"vip" in tags`, expected: "boolean"},
+		{input: `"math" in scores`, expected: "boolean"},
+		{input: `"Ad" in name`, expected: "boolean"},
+		{input: "nickname", expected: "string?"},
+		{input: "nickname ?? name", expected: "string"},
+		{input: "nickname ?? null", expected: "string?"},
+		{input: "missing ?? 1", expected: "integer"},
+		{input: "user.missing ?? 1", expected: "integer"},
+		{input: "age ?? 1", expected: "integer"},
+		{input: "alias ?? name", expected: "string"},
+		{input: "alias ?? 1", expected: "any"},
+		{input: "user.phone ?? name", expected: "string"},
+		{input: "user?.phone", expected: "string?"},
+		{input: `user["phone"] ?? null`, expected: "string?"},
+		{input: "premium ? 1 : 2", expected: "integer"},
+		{input: "premium ? 1 : null", expected: "integer?"},
+		{input: "premium ? 1 : 2.5", expected: "decimal"},
+		{input: "(premium ? 1 : 0.5) * age", expected: "decimal"},
+		{input: "[1, 2.5, null]", expected: "list[decimal?]"},
+		{input: "tags", expected: "list[string]"},
+		{input: "tags[0]", expected: "string"},
+		{input: "tags?.[0]", expected: "string?"},
+		{input: `scores["math"]`, expected: "decimal"},
+		{input: "scores.math", expected: "decimal"},
+		{input: "user.email", expected: "string"},
+		{input: "user.address", expected: "map{city: string, country: string, zip: integer?}"},
+		{input: `user.address["city"]`, expected: "string"},
+		{input: "user.address.zip ?? 0", expected: "integer"},
+		{input: "user.manager?.name", expected: "string?"},
+		{input: "user.manager?.name ?? name", expected: "string"},
+		{input: "user.manager.name ?? name", expected: "string"},
+		{input: "user.manager.name ?? 1", expected: "any"},
+		{input: "user.email.domain ?? 1", expected: "integer"},
+		{input: "age[0] ?? 1", expected: "integer"},
+		{input: "missing?.name", expected: "null"},
+		{input: "user.nope?.name ?? name", expected: "string"},
+		{input: "alias?.[0]", expected: "null"},
+		{input: "user?.manager.name", expected: "string?"},
+		{input: "missing?.name.first[0]", expected: "null"},
+		{input: "user?.address.zip", expected: "integer?"},
+		{input: "user?.orders[0].total", expected: "decimal?"},
+		{input: "user.orders[0].total", expected: "decimal"},
+		{input: "extra", expected: "any"},
+		{input: "extra.deep.path + 1", expected: "any"},
+		{input: "extra > 1", expected: "boolean"},
+		{input: "[1, 2, 3]", expected: "list[integer]"},
+		{input: "[1, null]", expected: "list[integer?]"},
+		{input: "[]", expected: "list[any]"},
+		{input: `{"a": 1, "b": name}`, expected: "map{a: integer, b: string}"},
+		{input: `{"a": 1}.a`, expected: "integer"},
+		{input: "abs(age)", expected: "integer"},
+		{input: "round(score, 2)", expected: "decimal"},
+		{input: "min(age, 3)", expected: "integer"},
+		{input: "max(age, score)", expected: "decimal"},
+		{input: "len(tags)", expected: "integer"},
+		{input: "upper(name)", expected: "string"},
+		{input: `startsWith(name, "A")`, expected: "boolean"},
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			typ, diags := Check(expr, testSchema)
+			require.Empty(t, diags)
+			require.Equal(t, c.expected, typ.String())
+		})
+	}
+}
+
+func TestCheckDiagnostics(t *testing.T) {
+	cases := []string{
+		"missing",
+		"user.missing",
+		"user.email.domain",
+		"user.manager.name",
+		"age + name",
+		`"a" < 1`,
+		"premium + 1",
+		"age && premium",
+		"premium || name",
+		"!age",
+		"-name",
+		"age == name",
+		"nickname == null",
+		"nickname + name",
+		"premium ? 1 : 2 ? 3 : 4",
+		"age ? 1 : 2",
+		"1 in age",
+		"age in scores",
+		"1 in name",
+		"tags[name]",
+		"scores[0]",
+		"age[0]",
+		`user.address["street"]`,
+		"(age + name) ?? 1",
+		"(premium ? 1 : 0.5) + name",
+		"tags[premium ? 1 : 0.5]",
+		"missing()",
+		"abs(1, 2)",
+		"abs(name)",
+		"round(score, 1.5)",
+		"len(age)",
+		"upper(nickname)",
+		`contains(name, 1)`,
+		"age + name > missing && unknown(premium)",
+		"1 +\n  missing.key *\n  name",
+		"unknown(missing)",
+		"premium ? missing : 1",
+		"alias",
+		"user.phone",
+		`user["phone"]`,
+		"len(alias)",
+		"sparse[0]",
+		"partial[name]",
+		"partial.a + 1",
+		"tags[missing]?.name",
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			typ, diags := Check(expr, testSchema)
+			require.NotEmpty(t, diags)
+			snaps.MatchSnapshot(t, typ.String(), diags)
+		})
+	}
+}
+
+func TestInterpreterCheck(t *testing.T) {
+	i := NewInterpreter()
+	i.RegisterFunc("discount", func(args []Value) (Value, error) { return DecimalValue(0.1), nil })
+	i.RegisterFuncArity("clamp", 3, 3, func(args []Value) (Value, error) { return args[0], nil })
+	i.RegisterFunc("upper", func(args []Value) (Value, error) { return args[0], nil })
+
+	cases := map[string]string{
+		"discount(age)":              "any",
+		"discount() * score":         "any",
+		"clamp(age, 0, 10)":          "any",
+		"upper(age)":                 "any",
+		"len(name) + abs(age)":       "integer",
+		"discount(nickname) ?? name": "any",
+	}
+	for input, expected := range cases {
+		t.Run(input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			typ, diags := i.Check(expr, testSchema)
+			require.Empty(t, diags)
+			require.Equal(t, expected, typ.String())
+		})
+	}
+
+	for input, kind := range map[string]RuntimeErrorKind{
+		"clamp(age)":   ArityMismatch,
+		"unknown(age)": UnknownFunction,
+	} {
+		t.Run(input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			_, diags := i.Check(expr, testSchema)
+			require.Len(t, diags, 1)
+			require.Equal(t, kind, diags[0].Kind)
+		})
+	}
+}
+
+// TestCheckAgreesWithEvaluate checks that expressions without diagnostics do
+// not fail with a TypeMismatch when evaluated against a state matching the
+// schema, and that their values have the inferred type.
+func TestCheckAgreesWithEvaluate(t *testing.T) {
+	state := map[string]any{
+		"age":      42,
+		"score":    1.5,
+		"name":     "Ada",
+		"premium":  true,
+		"nickname": nil,
+		"tags":     []string{"vip"},
+		"scores":   map[string]any{"math": 2.5},
+		"extra":    map[string]any{"deep": map[string]any{"path": 1}},
+		"user": map[string]any{
+			"email":   "ada@example.com",
+			"address": map[string]any{"city": "London", "country": "UK", "zip": nil},
+			"manager": nil,
+			"orders":  []any{map[string]any{"total": 12.5}},
+		},
+	}
+	inputs := []string{
+		"age + score * 2",
+		`name + (nickname ?? "")`,
+		"premium && age > 18 || tags[0] == name",
+		"user.manager?.name ?? user.email",
+		"user.manager.name ?? user.email",
+		"(premium ? age : score) * 2",
+		"max(age, score) + 1",
+		"user.email.domain ?? name",
+		"user.address.zip ?? len(user.address.city)",
+		"user.orders[0].total + extra.deep.path",
+		`premium ? upper(name) : lower(name)`,
+		"alias ?? name",
+		"user?.phone ?? name",
+		`user["phone"] ?? name`,
+	}
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			typ, diags := Check(expr, testSchema)
+			require.Empty(t, diags)
+
+			i, err := NewInterpreterWithState(state)
+			require.NoError(t, err)
+			val, err := i.Evaluate(expr)
+			require.NoError(t, err)
+			switch typ := nonNull(typ); typ.Kind {
+			case AnyType:
+			case DecimalType:
+				// Integers join decimals to DecimalType.
+				require.Contains(t, []string{"integer", "decimal"}, typeName(val))
+			default:
+				require.Equal(t, typ.Kind.String(), typeName(val))
+			}
+		})
+	}
+}
+
+func TestSchemaRoot(t *testing.T) {
+	declared := MapOf(map[string]Type{"a": {Kind: IntegerType}})
+	schema := Schema{
+		"m":     declared,
+		"m.b":   {Kind: StringType},
+		"o":     OptionalOf(MapOf(map[string]Type{"x": {Kind: IntegerType}})),
+		"o.x":   {Kind: IntegerType},
+		"o.y.z": {Kind: StringType},
+		"d":     DictOf(Type{Kind: IntegerType}),
+		"d.k":   {Kind: IntegerType},
+		"n":     {Kind: IntegerType},
+		"n.k":   {Kind: IntegerType},
+	}
+	root, conflicts := schema.root()
+	require.Equal(t, "map{a: integer, b: string}", root.Fields["m"].String())
+	require.Equal(t, "map{x: integer, y: map{z: string}}?", root.Fields["o"].String())
+	require.Equal(t, "map[integer]", root.Fields["d"].String())
+	require.Equal(t, "integer", root.Fields["n"].String())
+	require.Equal(t, []string{"d.k", "n.k"}, conflicts)
+	require.Equal(t, "map{a: integer}", declared.String())
+	require.Error(t, schema.Validate())
+	require.NoError(t, testSchema.Validate())
+}
+
+func TestSchemaRootCheck(t *testing.T) {
+	cases := []struct {
+		schema Schema
+		input  string
+		kind   RuntimeErrorKind
+	}{
+		{
+			schema: Schema{"m": OptionalOf(MapOf(map[string]Type{"x": {Kind: IntegerType}})), "m.x": {Kind: IntegerType}},
+			input:  "m.x",
+			kind:   NotAMap,
+		},
+		{
+			schema: Schema{"d": DictOf(Type{Kind: IntegerType}), "d.k": {Kind: IntegerType}},
+			input:  "d.other + d.k",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			_, diags := Check(expr, c.schema)
+			if c.kind == InvalidRuntimeError {
+				require.Empty(t, diags)
+				return
+			}
+			require.Len(t, diags, 1)
+			require.Equal(t, c.kind, diags[0].Kind)
+		})
+	}
+}
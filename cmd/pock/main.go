@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -15,24 +16,46 @@ import (
 
 const version = "0.0.0"
 
-var statePath = flag.String("state", "", "a JSON file to be loaded as interpreter state")
+var (
+	statePath  = flag.String("state", "", "a JSON file to be loaded as interpreter state")
+	schemaPath = flag.String("schema", "", "a JSON schema file to check expressions against")
+)
 
 func main() {
 	flag.Parse()
-	var interpreter *pock.Interpreter
-	if *statePath == "" {
-		interpreter = pock.NewInterpreter()
-	} else {
-		var state map[string]any
+	if flag.Arg(0) == "schema" {
+		inferSchema(flag.Args()[1:])
+		return
+	}
+
+	var state map[string]any
+	if *statePath != "" {
 		buf, err := os.ReadFile(*statePath)
 		if err != nil {
 			panic(err.Error())
 		}
-		err = json.Unmarshal(buf, &state)
+		err = decodeState(buf, &state)
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+
+	env, err := pock.NewMapEnv(state)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	var schema pock.Schema
+	if *schemaPath != "" {
+		buf, err := os.ReadFile(*schemaPath)
+		if err != nil {
+			panic(err.Error())
+		}
+		err = json.Unmarshal(buf, &schema)
 		if err != nil {
 			panic(err.Error())
 		}
-		interpreter, err = pock.NewInterpreterWithState(state)
+		err = schema.Validate()
 		if err != nil {
 			panic(err.Error())
 		}
@@ -44,28 +67,62 @@ func main() {
 	if err != nil {
 		panic(err.Error())
 	}
+	// Lines are accumulated until they form a complete expression, so that
+	// expressions can span several lines. An empty line ends the expression
+	// regardless.
+	var lines []string
+	reset := func() {
+		lines = nil
+		rl.SetPrompt("> ")
+	}
 	for {
-		src, err := rl.Readline()
+		line, err := rl.Readline()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				return
 			}
+			if errors.Is(err, readline.ErrInterrupt) {
+				reset()
+				continue
+			}
 			panic(err.Error())
 		}
+		lines = append(lines, line)
+		src := strings.Join(lines, "\n")
 
-		tokens, err := pock.Scan(strings.NewReader(src))
-		if err != nil {
-			fmt.Printf("scan error: %s\n", err)
+		if strings.TrimSpace(src) == "" {
+			reset()
 			continue
 		}
 
-		expr, err := pock.Parse(tokens)
+		program, err := pock.Compile(src)
 		if err != nil {
-			fmt.Printf("parse error: %s\n", err)
+			if incomplete(err) && line != "" {
+				rl.SetPrompt("... ")
+				continue
+			}
+			reset()
+			var scanErr *pock.ScanError
+			if errors.As(err, &scanErr) {
+				fmt.Printf("scan error: %s\n", err)
+			} else {
+				fmt.Printf("parse error: %s\n", err)
+			}
 			continue
 		}
+		reset()
 
-		value, err := interpreter.Evaluate(expr)
+		if schema != nil {
+			_, diags := program.Check(schema)
+			for _, d := range diags {
+				fmt.Printf("type error: %s\n", d)
+			}
+			if len(diags) > 0 {
+				continue
+			}
+		}
+
+		value, err := program.Run(env)
 		if err != nil {
 			fmt.Printf("error: %s\n", err)
 			continue
@@ -81,8 +138,77 @@ func main() {
 			fmt.Print(v)
 		} else if _, ok := value.GetNull(); ok {
 			fmt.Print("null")
+		} else {
+			buf, err := json.Marshal(value)
+			if err != nil {
+				fmt.Printf("error: %s\n", err)
+				continue
+			}
+			fmt.Print(string(buf))
 		}
 
 		fmt.Println()
 	}
 }
+
+// inferSchema prints the schema inferred from the JSON state files at paths,
+// or from a single state read from stdin if paths is empty.
+func inferSchema(paths []string) {
+	var samples []map[string]any
+	read := func(buf []byte) {
+		var state map[string]any
+		err := decodeState(buf, &state)
+		if err != nil {
+			panic(err.Error())
+		}
+		samples = append(samples, state)
+	}
+	if len(paths) == 0 {
+		buf, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			panic(err.Error())
+		}
+		read(buf)
+	}
+	for _, path := range paths {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			panic(err.Error())
+		}
+		read(buf)
+	}
+
+	schema, err := pock.InferSchema(samples...)
+	if err != nil {
+		panic(err.Error())
+	}
+	buf, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		panic(err.Error())
+	}
+	fmt.Println(string(buf))
+}
+
+// decodeState decodes a JSON state from buf into state. Numbers are decoded as
+// json.Number, so that integers are loaded as integers rather than decimals.
+func decodeState(buf []byte, state *map[string]any) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	err := dec.Decode(state)
+	if err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// incomplete reports whether err was caused by the source ending prematurely.
+func incomplete(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var parseErr *pock.ParseError
+	return errors.As(err, &parseErr) && parseErr.Span.Start == parseErr.Span.End
+}
@@ -0,0 +1,99 @@
+package pock
+
+import (
+	"sync"
+)
+
+// Env provides the variables of an evaluation. Lookup returns the value at
+// path, where path[0] is the name of a variable and the following names are
+// keys in nested maps, as in `user.address.city`. Implementations must be safe
+// for concurrent use if the Env is shared by concurrent evaluations.
+type Env interface {
+	Lookup(path []string) (Value, bool)
+}
+
+// MapEnv is an Env backed by a map of values.
+type MapEnv map[string]Value
+
+// NewMapEnv loads state into a MapEnv, converting Go values as
+// Interpreter.LoadState does.
+func NewMapEnv(state map[string]any) (MapEnv, error) {
+	env := make(MapEnv, len(state))
+	err := loadState(env, state, nil)
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func (e MapEnv) Lookup(path []string) (Value, bool) {
+	return lookupPath(MapValue(e), path)
+}
+
+type layeredEnv struct {
+	parent Env
+	child  Env
+}
+
+// NewLayeredEnv returns an Env that looks up variables in child, then in
+// parent. A variable defined in child hides the variable of the same name in
+// parent entirely, including its keys.
+func NewLayeredEnv(parent, child Env) Env {
+	return layeredEnv{parent: parent, child: child}
+}
+
+func (e layeredEnv) Lookup(path []string) (Value, bool) {
+	if val, ok := e.child.Lookup(path); ok {
+		return val, true
+	}
+	if _, ok := e.child.Lookup(path[:1]); ok {
+		return nil, false
+	}
+	return e.parent.Lookup(path)
+}
+
+type lazyEnv map[string]*lazyValue
+
+type lazyValue struct {
+	once sync.Once
+	fn   func() Value
+	val  Value
+}
+
+// NewLazyEnv returns an Env whose variables are computed by the functions in
+// vars the first time they are looked up. Each function is called at most
+// once, even by concurrent evaluations, and may return nil if the variable does
+// not exist.
+func NewLazyEnv(vars map[string]func() Value) Env {
+	env := make(lazyEnv, len(vars))
+	for name, fn := range vars {
+		env[name] = &lazyValue{fn: fn}
+	}
+	return env
+}
+
+func (e lazyEnv) Lookup(path []string) (Value, bool) {
+	v, ok := e[path[0]]
+	if !ok {
+		return nil, false
+	}
+	v.once.Do(func() { v.val = v.fn() })
+	if v.val == nil {
+		return nil, false
+	}
+	return lookupPath(v.val, path[1:])
+}
+
+// lookupPath looks up the keys of path in nested maps, starting from val.
+func lookupPath(val Value, path []string) (Value, bool) {
+	for _, name := range path {
+		obj, ok := val.(MapValue)
+		if !ok {
+			return nil, false
+		}
+		if val, ok = obj[name]; !ok {
+			return nil, false
+		}
+	}
+	return val, true
+}
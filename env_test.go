@@ -0,0 +1,159 @@
+package pock
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapEnv(t *testing.T) {
+	env, err := NewMapEnv(map[string]any{
+		"hello": map[string]any{"world": 1138},
+		"xs":    []int{1, 2, 3},
+	})
+	require.NoError(t, err)
+
+	val, ok := env.Lookup([]string{"hello", "world"})
+	require.True(t, ok)
+	require.Equal(t, IntValue(1138), val)
+	val, ok = env.Lookup([]string{"xs"})
+	require.True(t, ok)
+	require.Equal(t, ListValue{IntValue(1), IntValue(2), IntValue(3)}, val)
+	_, ok = env.Lookup([]string{"hello", "missing"})
+	require.False(t, ok)
+	_, ok = env.Lookup([]string{"hello", "world", "missing"})
+	require.False(t, ok)
+	_, ok = env.Lookup([]string{"missing"})
+	require.False(t, ok)
+
+	_, err = NewMapEnv(map[string]any{"bad": func() {}})
+	require.Error(t, err)
+}
+
+func TestLayeredEnv(t *testing.T) {
+	parent := MapEnv{
+		"a": IntValue(1),
+		"b": MapValue{"x": IntValue(2), "y": IntValue(3)},
+	}
+	child := MapEnv{
+		"b": MapValue{"x": IntValue(4)},
+		"c": IntValue(5),
+	}
+	env := NewLayeredEnv(parent, child)
+
+	type testCase struct {
+		path     string
+		expected Value
+	}
+	cases := []testCase{
+		{path: "a", expected: IntValue(1)},
+		{path: "b.x", expected: IntValue(4)},
+		{path: "b.y", expected: nil},
+		{path: "c", expected: IntValue(5)},
+		{path: "d", expected: nil},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			val, ok := env.Lookup(strings.Split(c.path, "."))
+			require.Equal(t, c.expected != nil, ok)
+			require.Equal(t, c.expected, val)
+		})
+	}
+}
+
+func TestLazyEnv(t *testing.T) {
+	var calls atomic.Int32
+	env := NewLazyEnv(map[string]func() Value{
+		"user": func() Value {
+			calls.Add(1)
+			return MapValue{"name": StringValue("pock")}
+		},
+		"nothing": func() Value {
+			return nil
+		},
+	})
+
+	vals := make([]Value, 100)
+	oks := make([]bool, 100)
+	var wg sync.WaitGroup
+	for n := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vals[n], oks[n] = env.Lookup([]string{"user", "name"})
+		}()
+	}
+	wg.Wait()
+	for n := range 100 {
+		require.True(t, oks[n])
+		require.Equal(t, StringValue("pock"), vals[n])
+	}
+	require.EqualValues(t, 1, calls.Load())
+
+	_, ok := env.Lookup([]string{"user", "age"})
+	require.False(t, ok)
+	_, ok = env.Lookup([]string{"nothing"})
+	require.False(t, ok)
+	_, ok = env.Lookup([]string{"missing"})
+	require.False(t, ok)
+}
+
+func TestInterpreterEvaluateEnv(t *testing.T) {
+	i := NewInterpreter()
+	i.LoadInt("threshold", 18)
+	i.LoadInt("age", 0)
+
+	p, err := Compile("age >= threshold")
+	require.NoError(t, err)
+
+	vals := make([]Value, 100)
+	errs := make([]error, 100)
+	var wg sync.WaitGroup
+	for age := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vals[age], errs[age] = i.EvaluateEnv(p.expr, MapEnv{"age": IntValue(age)})
+		}()
+	}
+	wg.Wait()
+	for age := range 100 {
+		require.NoError(t, errs[age])
+		require.Equal(t, BoolValue(age >= 18), vals[age])
+	}
+
+	val, err := i.Evaluate(p.expr)
+	require.NoError(t, err)
+	require.Equal(t, BoolValue(false), val)
+}
+
+func TestInterpreterEvaluateEnvError(t *testing.T) {
+	env := NewLazyEnv(map[string]func() Value{
+		"hello": func() Value { return MapValue{"world": IntValue(1138)} },
+	})
+
+	type testCase struct {
+		input string
+		kind  RuntimeErrorKind
+	}
+	cases := []testCase{
+		{input: "missing", kind: UnknownVariable},
+		{input: "missing.world", kind: UnknownVariable},
+		{input: "hello.missing", kind: UnknownKey},
+		{input: "hello.world.missing", kind: NotAMap},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			p, err := Compile(c.input)
+			require.NoError(t, err)
+			_, err = p.Run(env)
+			var runtimeErr *RuntimeError
+			require.True(t, errors.As(err, &runtimeErr))
+			require.Equal(t, c.kind, runtimeErr.Kind)
+		})
+	}
+}
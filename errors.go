@@ -0,0 +1,169 @@
+package pock
+
+import (
+	"fmt"
+)
+
+// ScanError is returned by Scan when the source cannot be split into tokens.
+type ScanError struct {
+	Span Span
+	Msg  string
+	Err  error
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span, e.Msg)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError is returned by Parse when the tokens do not form a valid
+// expression. Span is the span of the offending token, or an empty span at the
+// end of the source if the expression ended prematurely.
+type ParseError struct {
+	Span Span
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span, e.Msg)
+}
+
+type RuntimeErrorKind int
+
+const (
+	// Guard value
+	InvalidRuntimeError RuntimeErrorKind = iota
+
+	// Operands have the wrong type for the operator
+	TypeMismatch
+
+	// Variable lookups
+	UnknownVariable
+	UnknownKey
+	// A key or an index is read from a value that is neither a map nor a list
+	NotAMap
+	IndexOutOfRange
+
+	// Arithmetic
+	DivisionByZero
+	IntegerOverflow
+
+	// Function calls
+	UnknownFunction
+	ArityMismatch
+	CallFailed
+)
+
+func (k RuntimeErrorKind) String() string {
+	switch k {
+	case InvalidRuntimeError:
+		return "InvalidRuntimeError"
+	case TypeMismatch:
+		return "TypeMismatch"
+	case UnknownVariable:
+		return "UnknownVariable"
+	case UnknownKey:
+		return "UnknownKey"
+	case NotAMap:
+		return "NotAMap"
+	case IndexOutOfRange:
+		return "IndexOutOfRange"
+	case DivisionByZero:
+		return "DivisionByZero"
+	case IntegerOverflow:
+		return "IntegerOverflow"
+	case UnknownFunction:
+		return "UnknownFunction"
+	case ArityMismatch:
+		return "ArityMismatch"
+	case CallFailed:
+		return "CallFailed"
+	}
+	return "Unknown"
+}
+
+func (k RuntimeErrorKind) GoString() string {
+	return k.String()
+}
+
+// RuntimeError is returned by Interpreter.Evaluate. Span is the span of the
+// expression that failed, and Operands holds the type names of the offending
+// operands, if any. Err holds the error returned by a function for CallFailed
+// errors.
+type RuntimeError struct {
+	Kind     RuntimeErrorKind
+	Span     Span
+	Msg      string
+	Operands []string
+	Err      error
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span, e.Msg)
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+type LimitKind int
+
+const (
+	// Guard value
+	InvalidLimit LimitKind = iota
+
+	// Limits set with options
+	SourceLengthLimit
+	DepthLimit
+	StepLimit
+	StringLengthLimit
+
+	// The context of the evaluation was canceled or its deadline passed
+	Interrupted
+)
+
+func (k LimitKind) String() string {
+	switch k {
+	case InvalidLimit:
+		return "InvalidLimit"
+	case SourceLengthLimit:
+		return "SourceLengthLimit"
+	case DepthLimit:
+		return "DepthLimit"
+	case StepLimit:
+		return "StepLimit"
+	case StringLengthLimit:
+		return "StringLengthLimit"
+	case Interrupted:
+		return "Interrupted"
+	}
+	return "Unknown"
+}
+
+func (k LimitKind) GoString() string {
+	return k.String()
+}
+
+// LimitError is returned when compiling, parsing or evaluating an expression
+// exceeds a limit. Limit is the value of the limit that was exceeded, and Span
+// is the span of the expression or token that exceeded it, or an empty span at
+// the start of the source for its length. Err holds the error of the context
+// for Interrupted errors.
+type LimitError struct {
+	Kind  LimitKind
+	Limit int
+	Span  Span
+	Msg   string
+	Err   error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span, e.Msg)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
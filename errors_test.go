@@ -0,0 +1,85 @@
+package pock
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanErrorAs(t *testing.T) {
+	_, err := Scan(strings.NewReader("1 +\n 2 & 3"))
+	var scanErr *ScanError
+	require.ErrorAs(t, err, &scanErr)
+	require.Equal(t, Position{Offset: 7, Line: 2, Column: 4}, scanErr.Span.Start)
+
+	_, err = Scan(strings.NewReader("1.2.3"))
+	var numErr *strconv.NumError
+	require.ErrorAs(t, err, &numErr)
+
+	for _, src := range []string{`"hello`, "`hello", "/* hello"} {
+		_, err = Scan(strings.NewReader(src))
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	}
+	_, err = Scan(strings.NewReader("1 & 2"))
+	require.NotErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestParseErrorAs(t *testing.T) {
+	tokens, err := Scan(strings.NewReader("(1 + 2"))
+	require.NoError(t, err)
+	_, err = Parse(tokens)
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	require.Equal(t, Position{Offset: 6, Line: 1, Column: 7}, parseErr.Span.Start)
+}
+
+func TestRuntimeErrorAs(t *testing.T) {
+	type testCase struct {
+		input    string
+		kind     RuntimeErrorKind
+		operands []string
+	}
+	cases := []testCase{
+		{input: `1 + "hello"`, kind: TypeMismatch, operands: []string{"integer", "string"}},
+		{input: "false || 1", kind: TypeMismatch, operands: []string{"boolean", "integer"}},
+		{input: "-true", kind: TypeMismatch, operands: []string{"boolean"}},
+		{input: "1 == null", kind: TypeMismatch, operands: []string{"integer", "null"}},
+		{input: "missing", kind: UnknownVariable},
+		{input: "hello.missing", kind: UnknownKey},
+		{input: "hello.world.missing", kind: NotAMap},
+		{input: "hello[1]", kind: TypeMismatch, operands: []string{"integer"}},
+		{input: "[1][1]", kind: IndexOutOfRange},
+		{input: `[1]["a"]`, kind: TypeMismatch, operands: []string{"string"}},
+		{input: `1 in "hello"`, kind: TypeMismatch, operands: []string{"integer", "string"}},
+		{input: "1 / 0", kind: DivisionByZero},
+		{input: `"yes" ? 1 : 2`, kind: TypeMismatch, operands: []string{"string"}},
+		{input: "missing()", kind: UnknownFunction},
+		{input: "abs(1, 2)", kind: ArityMismatch},
+		{input: `abs("hello")`, kind: TypeMismatch, operands: []string{"string"}},
+		{input: "9223372036854775807 + 1", kind: IntegerOverflow, operands: []string{"integer", "integer"}},
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			i, err := NewInterpreterWithState(map[string]any{
+				"hello": map[string]any{"world": 1138},
+			})
+			require.NoError(t, err)
+			_, err = i.Evaluate(expr)
+			var runtimeErr *RuntimeError
+			require.True(t, errors.As(err, &runtimeErr))
+			require.Equal(t, c.kind, runtimeErr.Kind)
+			require.Equal(t, c.operands, runtimeErr.Operands)
+			require.Equal(t, SpanOf(expr), runtimeErr.Span)
+		})
+	}
+}
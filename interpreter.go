@@ -1,19 +1,130 @@
 package pock
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
 )
 
 type Interpreter struct {
-	variables map[string]any
+	variables map[string]Value
+	functions map[string]function
+
+	// env and eval are the environment and the state of the current
+	// evaluation. They are only set on the copy of the Interpreter made by
+	// EvaluateEnv and EvaluateContext.
+	env  Env
+	eval *evaluation
+
+	promoteOverflow bool
+	limits          limits
+}
+
+// limits bounds the resources used by an expression. A zero limit is no limit.
+type limits struct {
+	maxSourceLength int
+	maxDepth        int
+	maxSteps        int
+	maxStringLength int
+}
+
+// evaluation is the state of a single evaluation, shared by the copies of the
+// Interpreter made while evaluating.
+type evaluation struct {
+	ctx    context.Context
+	limits limits
+	steps  int
+	depth  int
+}
+
+// contextCheckInterval is the number of steps between checks of the context
+// of an evaluation.
+const contextCheckInterval = 64
+
+// Func is a function that can be called from expressions. It receives the
+// evaluated arguments of the call.
+type Func func(args []Value) (Value, error)
+
+type function struct {
+	fn      Func
+	minArgs int
+	maxArgs int
+	// builtin is set for the builtin functions, whose result types are known
+	// to Check, until they are replaced with RegisterFunc.
+	builtin bool
+}
+
+type Option func(*Interpreter)
+
+// WithOverflowPromotion makes integer arithmetic that overflows return a
+// decimal result instead of an IntegerOverflow error.
+func WithOverflowPromotion() Option {
+	return func(i *Interpreter) {
+		i.promoteOverflow = true
+	}
 }
 
-func NewInterpreter() *Interpreter {
-	return &Interpreter{variables: map[string]any{}}
+// WithFunc registers fn as name, as RegisterFuncArity does, so that programs
+// compiled with the option can call it.
+func WithFunc(name string, minArgs, maxArgs int, fn Func) Option {
+	return func(i *Interpreter) {
+		i.RegisterFuncArity(name, minArgs, maxArgs, fn)
+	}
 }
 
-func NewInterpreterWithState(state map[string]any) (*Interpreter, error) {
-	i := NewInterpreter()
+// WithMaxSourceLength makes Compile reject sources longer than n bytes.
+func WithMaxSourceLength(n int) Option {
+	return func(i *Interpreter) {
+		i.limits.maxSourceLength = n
+	}
+}
+
+// WithMaxDepth sets the maximum depth of the expressions compiled and
+// evaluated, DefaultMaxDepth by default. A maximum depth of 0 disables the
+// limit, letting deeply nested expressions exhaust the stack.
+func WithMaxDepth(n int) Option {
+	return func(i *Interpreter) {
+		i.limits.maxDepth = n
+	}
+}
+
+// WithMaxSteps makes evaluation fail after n steps. A step is the evaluation
+// of a sub-expression by the interpreter, or the execution of an instruction
+// by a Program.
+func WithMaxSteps(n int) Option {
+	return func(i *Interpreter) {
+		i.limits.maxSteps = n
+	}
+}
+
+// WithMaxStringLength makes evaluation fail when an operator or a function
+// returns a string longer than n bytes.
+func WithMaxStringLength(n int) Option {
+	return func(i *Interpreter) {
+		i.limits.maxStringLength = n
+	}
+}
+
+func NewInterpreter(opts ...Option) *Interpreter {
+	i := &Interpreter{
+		variables: map[string]Value{},
+		functions: map[string]function{},
+		limits:    limits{maxDepth: DefaultMaxDepth},
+	}
+	for name, f := range builtins {
+		i.functions[name] = f
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+func NewInterpreterWithState(state map[string]any, opts ...Option) (*Interpreter, error) {
+	i := NewInterpreter(opts...)
 	err := i.LoadState(state)
 	if err != nil {
 		return nil, err
@@ -21,71 +132,256 @@ func NewInterpreterWithState(state map[string]any) (*Interpreter, error) {
 	return i, nil
 }
 
+// LoadState loads every entry of state as a variable. Values may be booleans,
+// numbers, strings, nil, Values, or any slice, array, map with string keys,
+// struct or pointer to such values. Struct fields are named after their `pock`
+// or `json` tag, fields of embedded structs are promoted, and time.Time values
+// are loaded as strings in the time.RFC3339Nano format. json.Number values, as
+// decoded with json.Decoder.UseNumber, are loaded as integers when they are
+// written as integers, and as decimals otherwise.
 func (s *Interpreter) LoadState(state map[string]any) error {
-	return loadState(s.variables, state)
+	return loadState(s.variables, state, nil)
 }
 
-func loadState(base, state map[string]any) error {
+func loadState(base map[string]Value, state map[string]any, seen map[uintptr]bool) error {
 	for k, v := range state {
-		switch v := v.(type) {
-		case int64, float64, string, bool, nil:
-			base[k] = v
-		case int:
-			base[k] = int64(v)
-		case int8:
-			base[k] = int64(v)
-		case int16:
-			base[k] = int64(v)
-		case int32:
-			base[k] = int64(v)
-		case uint:
-			base[k] = int64(v)
-		case uint8:
-			base[k] = int64(v)
-		case uint16:
-			base[k] = int64(v)
-		case uint32:
-			base[k] = int64(v)
-		case uint64:
-			base[k] = int64(v)
-		case float32:
-			base[k] = float64(v)
-		case map[string]any:
-			base[k] = map[string]any{}
-			err := loadState(base[k].(map[string]any), v)
-			if err != nil {
-				return err
-			}
-		default:
-			return fmt.Errorf("invalid type: %T", v)
+		val, err := loadAny(v, seen)
+		if err != nil {
+			return err
+		}
+		base[k] = val
+	}
+	return nil
+}
+
+func loadValue(v any) (Value, error) {
+	return loadAny(v, nil)
+}
+
+// loadAny is loadValue, with seen holding the maps, slices and pointers being
+// converted, as in loadReflect.
+func loadAny(v any, seen map[uintptr]bool) (Value, error) {
+	switch v := v.(type) {
+	case bool:
+		return BoolValue(v), nil
+	case int64:
+		return IntValue(v), nil
+	case float64:
+		return DecimalValue(v), nil
+	case string:
+		return StringValue(v), nil
+	case nil:
+		return null, nil
+	case int:
+		return IntValue(v), nil
+	case int8:
+		return IntValue(v), nil
+	case int16:
+		return IntValue(v), nil
+	case int32:
+		return IntValue(v), nil
+	case uint:
+		return loadUint(uint64(v))
+	case uint8:
+		return IntValue(v), nil
+	case uint16:
+		return IntValue(v), nil
+	case uint32:
+		return IntValue(v), nil
+	case uint64:
+		return loadUint(v)
+	case float32:
+		return DecimalValue(v), nil
+	case Value:
+		return v, nil
+	case map[string]any:
+		return loadMap(v, seen)
+	case []any:
+		return loadList(v, seen)
+	case []map[string]any:
+		return loadList(v, seen)
+	case []string:
+		return loadList(v, seen)
+	case []int:
+		return loadList(v, seen)
+	case []int64:
+		return loadList(v, seen)
+	case []float64:
+		return loadList(v, seen)
+	case []bool:
+		return loadList(v, seen)
+	}
+	return loadReflect(reflect.ValueOf(v), seen)
+}
+
+func loadMap(state map[string]any, seen map[uintptr]bool) (MapValue, error) {
+	seen, leave, err := enter(seen, reflect.ValueOf(state))
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+	m := MapValue{}
+	err = loadState(m, state, seen)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func loadList[T any](items []T, seen map[uintptr]bool) (ListValue, error) {
+	seen, leave, err := enter(seen, reflect.ValueOf(items))
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+	list := make(ListValue, len(items))
+	for i, item := range items {
+		val, err := loadAny(item, seen)
+		if err != nil {
+			return nil, err
 		}
+		list[i] = val
 	}
+	return list, nil
+}
+
+// LoadValue loads value as the variable name. value may be any value accepted
+// by LoadState, including structs, which are loaded as maps of their exported
+// fields.
+func (s *Interpreter) LoadValue(name string, value any) error {
+	val, err := loadValue(value)
+	if err != nil {
+		return err
+	}
+	s.variables[name] = val
 	return nil
 }
 
 func (s *Interpreter) LoadInt(name string, value int64) {
-	s.variables[name] = value
+	s.variables[name] = IntValue(value)
 }
 
 func (s *Interpreter) LoadDecimal(name string, value float64) {
-	s.variables[name] = value
+	s.variables[name] = DecimalValue(value)
 }
 
 func (s *Interpreter) LoadBool(name string, value bool) {
-	s.variables[name] = value
+	s.variables[name] = BoolValue(value)
 }
 
 func (s *Interpreter) LoadNull(name string) {
-	s.variables[name] = nil
+	s.variables[name] = null
 }
 
 func (s *Interpreter) LoadMap(name string, value map[string]any) error {
-	s.variables[name] = map[string]any{}
-	return loadState(s.variables[name].(map[string]any), value)
+	m, err := loadMap(value, nil)
+	if err != nil {
+		return err
+	}
+	s.variables[name] = m
+	return nil
 }
 
+func (s *Interpreter) LoadList(name string, value []any) error {
+	list, err := loadList(value, nil)
+	if err != nil {
+		return err
+	}
+	s.variables[name] = list
+	return nil
+}
+
+// RegisterFunc makes fn callable as name in expressions, replacing any function
+// already registered under that name. fn accepts any number of arguments; use
+// RegisterFuncArity to have the interpreter check the argument count.
+func (s *Interpreter) RegisterFunc(name string, fn Func) {
+	s.RegisterFuncArity(name, 0, -1, fn)
+}
+
+// RegisterFuncArity makes fn callable as name in expressions with at least
+// minArgs and at most maxArgs arguments. A negative maxArgs means there is no
+// upper bound.
+func (s *Interpreter) RegisterFuncArity(name string, minArgs, maxArgs int, fn Func) {
+	s.functions[name] = function{fn: fn, minArgs: minArgs, maxArgs: maxArgs}
+}
+
+// Check checks expr against schema as Check does, but knows the functions
+// registered in the interpreter: calls to them are checked for their argument
+// count, and their results have type AnyType.
+func (s Interpreter) Check(expr Expr, schema Schema) (Type, []Diagnostic) {
+	return check(expr, schema, s.functions)
+}
+
+// Evaluate evaluates expr against the variables loaded in the interpreter.
 func (s Interpreter) Evaluate(expr Expr) (Value, error) {
+	return s.EvaluateEnv(expr, nil)
+}
+
+// EvaluateContext evaluates expr against the variables loaded in the
+// interpreter, failing with an Interrupted *LimitError as soon as ctx is
+// canceled or its deadline passes.
+func (s Interpreter) EvaluateContext(ctx context.Context, expr Expr) (Value, error) {
+	return s.evaluateContext(ctx, expr, nil)
+}
+
+// EvaluateEnv evaluates expr against env, layered over the variables loaded in
+// the interpreter. The interpreter is not modified, so a single Interpreter can
+// evaluate expressions concurrently against different environments, as long as
+// no variables are loaded and no functions are registered at the same time.
+func (s Interpreter) EvaluateEnv(expr Expr, env Env) (Value, error) {
+	return s.evaluateContext(context.Background(), expr, env)
+}
+
+func (s Interpreter) evaluateContext(ctx context.Context, expr Expr, env Env) (Value, error) {
+	if err := interrupted(ctx, SpanOf(expr)); err != nil {
+		return nil, err
+	}
+	s.env = s.layer(env)
+	s.eval = &evaluation{ctx: ctx, limits: s.limits}
+	return s.evaluate(expr)
+}
+
+// layer returns env layered over the variables loaded in the interpreter.
+func (s Interpreter) layer(env Env) Env {
+	switch {
+	case env == nil:
+		return MapEnv(s.variables)
+	case len(s.variables) == 0:
+		return env
+	}
+	return NewLayeredEnv(MapEnv(s.variables), env)
+}
+
+func (s Interpreter) evaluate(expr Expr) (Value, error) {
+	if err := s.eval.step(expr); err != nil {
+		return nil, err
+	}
+	s.eval.depth++
+	val, err := s.evaluateExpr(expr)
+	s.eval.depth--
+	return val, err
+}
+
+// step counts the evaluation of expr against the limits of the interpreter,
+// and checks the context of the evaluation every contextCheckInterval steps.
+func (e *evaluation) step(expr Expr) error {
+	e.steps++
+	if e.limits.maxSteps > 0 && e.steps > e.limits.maxSteps {
+		return stepError(SpanOf(expr), e.limits.maxSteps)
+	}
+	if e.limits.maxDepth > 0 && e.depth >= e.limits.maxDepth {
+		return depthError(SpanOf(expr), e.limits.maxDepth)
+	}
+	if e.steps%contextCheckInterval == 0 {
+		return interrupted(e.ctx, SpanOf(expr))
+	}
+	return nil
+}
+
+func (s Interpreter) evaluateExpr(expr Expr) (Value, error) {
 	switch expr := expr.(type) {
+	case ConditionalExpr:
+		return s.evaluateConditional(expr)
 	case BinaryExpr:
 		return s.evaluateBinary(expr)
 	case UnaryExpr:
@@ -94,34 +390,58 @@ func (s Interpreter) Evaluate(expr Expr) (Value, error) {
 		return s.evaluateGroup(expr)
 	case GetExpr:
 		return s.evaluateGet(expr)
+	case IndexExpr:
+		return s.evaluateIndex(expr)
+	case CallExpr:
+		return s.evaluateCall(expr)
+	case ListExpr:
+		return s.evaluateList(expr)
+	case MapExpr:
+		return s.evaluateMap(expr)
 	case LiteralExpr:
 		return s.evaluateLiteral(expr)
 	}
 	panic("invalid expression")
 }
 
+func (s Interpreter) evaluateConditional(expr ConditionalExpr) (Value, error) {
+	cond, err := s.evaluate(expr.Cond)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := cond.(BoolValue)
+	if !ok {
+		return nil, typeError(expr.Span, "`?:` condition must be boolean", cond)
+	}
+	if c {
+		return s.evaluate(expr.Then)
+	}
+	return s.evaluate(expr.Else)
+}
+
 func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
-	left, err := s.Evaluate(expr.Left)
+	if expr.Op == Or || expr.Op == And {
+		return s.evaluateLogical(expr)
+	}
+	if expr.Op == QuestionQuestion {
+		return s.evaluateCoalesce(expr)
+	}
+
+	left, err := s.evaluate(expr.Left)
 	if err != nil {
 		return nil, err
 	}
-	right, err := s.Evaluate(expr.Right)
+	right, err := s.evaluate(expr.Right)
 	if err != nil {
 		return nil, err
 	}
-	switch expr.Op {
-	case Or:
-		left, right, ok := checkBinary[BoolValue, BoolValue](left, right)
-		if !ok {
-			return nil, fmt.Errorf("`||` operands must be boolean")
-		}
-		return left || right, nil
-	case And:
-		left, right, ok := checkBinary[BoolValue, BoolValue](left, right)
-		if !ok {
-			return nil, fmt.Errorf("`&&` operands must be boolean")
-		}
-		return left && right, nil
+	return s.binary(expr.Op, expr.Span, left, right)
+}
+
+// binary applies the comparison, arithmetic or `in` operator op to left and
+// right.
+func (s Interpreter) binary(op TokenType, span Span, left, right Value) (Value, error) {
+	switch op {
 	case Lt:
 		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
 			return BoolValue(left < right), nil
@@ -135,7 +455,10 @@ func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
 		if left, right, ok := checkBinary[DecimalValue, DecimalValue](left, right); ok {
 			return BoolValue(left < right), nil
 		}
-		return nil, fmt.Errorf("`<` operands must be integer or decimal")
+		if left, right, ok := checkBinary[StringValue, StringValue](left, right); ok {
+			return BoolValue(left < right), nil
+		}
+		return nil, numberOrStringError(op, span, left, right)
 	case Lte:
 		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
 			return BoolValue(left <= right), nil
@@ -149,7 +472,10 @@ func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
 		if left, right, ok := checkBinary[DecimalValue, DecimalValue](left, right); ok {
 			return BoolValue(left <= right), nil
 		}
-		return nil, fmt.Errorf("`<=` operands must be integer or decimal")
+		if left, right, ok := checkBinary[StringValue, StringValue](left, right); ok {
+			return BoolValue(left <= right), nil
+		}
+		return nil, numberOrStringError(op, span, left, right)
 	case Gt:
 		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
 			return BoolValue(left > right), nil
@@ -163,7 +489,10 @@ func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
 		if left, right, ok := checkBinary[DecimalValue, DecimalValue](left, right); ok {
 			return BoolValue(left > right), nil
 		}
-		return nil, fmt.Errorf("`>` operands must be integer or decimal")
+		if left, right, ok := checkBinary[StringValue, StringValue](left, right); ok {
+			return BoolValue(left > right), nil
+		}
+		return nil, numberOrStringError(op, span, left, right)
 	case Gte:
 		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
 			return BoolValue(left >= right), nil
@@ -177,7 +506,10 @@ func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
 		if left, right, ok := checkBinary[DecimalValue, DecimalValue](left, right); ok {
 			return BoolValue(left >= right), nil
 		}
-		return nil, fmt.Errorf("`>=` operands must be integer or decimal")
+		if left, right, ok := checkBinary[StringValue, StringValue](left, right); ok {
+			return BoolValue(left >= right), nil
+		}
+		return nil, numberOrStringError(op, span, left, right)
 	case Eq:
 		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
 			return BoolValue(left == right), nil
@@ -200,10 +532,11 @@ func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
 		if left, right, ok := checkBinary[NullValue, NullValue](left, right); ok {
 			return BoolValue(left == right), nil
 		}
-		return nil, fmt.Errorf(
-			"`==` operands mismatch: %s and %s",
-			typeName(left),
-			typeName(right),
+		return nil, typeError(
+			span,
+			fmt.Sprintf("`==` operands mismatch: %s and %s", typeName(left), typeName(right)),
+			left,
+			right,
 		)
 	case Neq:
 		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
@@ -227,14 +560,18 @@ func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
 		if left, right, ok := checkBinary[NullValue, NullValue](left, right); ok {
 			return BoolValue(left != right), nil
 		}
-		return nil, fmt.Errorf(
-			"`!=` operands mismatch: %s and %s",
-			typeName(left),
-			typeName(right),
+		return nil, typeError(
+			span,
+			fmt.Sprintf("`!=` operands mismatch: %s and %s", typeName(left), typeName(right)),
+			left,
+			right,
 		)
 	case Plus:
 		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
-			return IntValue(left + right), nil
+			if r, ok := addInt(int64(left), int64(right)); ok {
+				return IntValue(r), nil
+			}
+			return s.overflow(span, op, DecimalValue(left)+DecimalValue(right), left, right)
 		}
 		if left, right, ok := checkBinary[IntValue, DecimalValue](left, right); ok {
 			return DecimalValue(DecimalValue(left) + right), nil
@@ -245,10 +582,16 @@ func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
 		if left, right, ok := checkBinary[DecimalValue, DecimalValue](left, right); ok {
 			return DecimalValue(left + right), nil
 		}
-		return nil, fmt.Errorf("`+` operands must be integer or decimal")
+		if left, right, ok := checkBinary[StringValue, StringValue](left, right); ok {
+			return s.checkString(span, StringValue(left+right))
+		}
+		return nil, numberOrStringError(op, span, left, right)
 	case Minus:
 		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
-			return IntValue(left - right), nil
+			if r, ok := subInt(int64(left), int64(right)); ok {
+				return IntValue(r), nil
+			}
+			return s.overflow(span, op, DecimalValue(left)-DecimalValue(right), left, right)
 		}
 		if left, right, ok := checkBinary[IntValue, DecimalValue](left, right); ok {
 			return DecimalValue(DecimalValue(left) - right), nil
@@ -259,10 +602,13 @@ func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
 		if left, right, ok := checkBinary[DecimalValue, DecimalValue](left, right); ok {
 			return DecimalValue(left - right), nil
 		}
-		return nil, fmt.Errorf("`-` operands must be integer or decimal")
+		return nil, typeError(span, "`-` operands must be integer or decimal", left, right)
 	case Star:
 		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
-			return IntValue(left * right), nil
+			if r, ok := mulInt(int64(left), int64(right)); ok {
+				return IntValue(r), nil
+			}
+			return s.overflow(span, op, DecimalValue(left)*DecimalValue(right), left, right)
 		}
 		if left, right, ok := checkBinary[IntValue, DecimalValue](left, right); ok {
 			return DecimalValue(DecimalValue(left) * right), nil
@@ -273,9 +619,15 @@ func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
 		if left, right, ok := checkBinary[DecimalValue, DecimalValue](left, right); ok {
 			return DecimalValue(left * right), nil
 		}
-		return nil, fmt.Errorf("`*` operands must be integer or decimal")
+		return nil, typeError(span, "`*` operands must be integer or decimal", left, right)
 	case Slash:
 		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
+			if right == 0 {
+				return nil, runtimeErrorf(DivisionByZero, span, "integer division by zero")
+			}
+			if left == math.MinInt64 && right == -1 {
+				return s.overflow(span, op, -DecimalValue(left), left, right)
+			}
 			return IntValue(left / right), nil
 		}
 		if left, right, ok := checkBinary[IntValue, DecimalValue](left, right); ok {
@@ -287,36 +639,191 @@ func (s Interpreter) evaluateBinary(expr BinaryExpr) (Value, error) {
 		if left, right, ok := checkBinary[DecimalValue, DecimalValue](left, right); ok {
 			return DecimalValue(left / right), nil
 		}
-		return nil, fmt.Errorf("`/` operands must be integer or decimal")
+		return nil, typeError(span, "`/` operands must be integer or decimal", left, right)
+	case Percent:
+		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
+			if right == 0 {
+				return nil, runtimeErrorf(DivisionByZero, span, "integer modulo by zero")
+			}
+			return IntValue(left % right), nil
+		}
+		if left, right, ok := checkBinary[IntValue, DecimalValue](left, right); ok {
+			return DecimalValue(math.Mod(float64(left), float64(right))), nil
+		}
+		if left, right, ok := checkBinary[DecimalValue, IntValue](left, right); ok {
+			return DecimalValue(math.Mod(float64(left), float64(right))), nil
+		}
+		if left, right, ok := checkBinary[DecimalValue, DecimalValue](left, right); ok {
+			return DecimalValue(math.Mod(float64(left), float64(right))), nil
+		}
+		return nil, typeError(span, "`%` operands must be integer or decimal", left, right)
+	case StarStar:
+		if left, right, ok := checkBinary[IntValue, IntValue](left, right); ok {
+			promoted := DecimalValue(math.Pow(float64(left), float64(right)))
+			if right < 0 {
+				return promoted, nil
+			}
+			if r, ok := powInt(int64(left), int64(right)); ok {
+				return IntValue(r), nil
+			}
+			return s.overflow(span, op, promoted, left, right)
+		}
+		if left, right, ok := checkBinary[IntValue, DecimalValue](left, right); ok {
+			return DecimalValue(math.Pow(float64(left), float64(right))), nil
+		}
+		if left, right, ok := checkBinary[DecimalValue, IntValue](left, right); ok {
+			return DecimalValue(math.Pow(float64(left), float64(right))), nil
+		}
+		if left, right, ok := checkBinary[DecimalValue, DecimalValue](left, right); ok {
+			return DecimalValue(math.Pow(float64(left), float64(right))), nil
+		}
+		return nil, typeError(span, "`**` operands must be integer or decimal", left, right)
+	case In:
+		switch right := right.(type) {
+		case ListValue:
+			for _, item := range right {
+				if valuesEqual(left, item) {
+					return BoolValue(true), nil
+				}
+			}
+			return BoolValue(false), nil
+		case MapValue:
+			key, ok := left.(StringValue)
+			if !ok {
+				return nil, typeError(span, "`in` map key must be string", left, right)
+			}
+			_, ok = right[string(key)]
+			return BoolValue(ok), nil
+		case StringValue:
+			sub, ok := left.(StringValue)
+			if !ok {
+				return nil, typeError(span, "`in` substring must be string", left, right)
+			}
+			return BoolValue(strings.Contains(string(right), string(sub))), nil
+		}
+		return nil, typeError(
+			span,
+			fmt.Sprintf("`in` right operand must be list, map or string, got %s", typeName(right)),
+			left,
+			right,
+		)
+	}
+	panic(fmt.Sprintf("invalid binary operator: %s", op))
+}
+
+// evaluateLogical evaluates `||` and `&&`, only evaluating the right operand if
+// the left operand does not determine the result.
+func (s Interpreter) evaluateLogical(expr BinaryExpr) (Value, error) {
+	msg := logicalMessage(expr.Op)
+
+	left, err := s.evaluate(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := left.(BoolValue)
+	if !ok {
+		return nil, typeError(expr.Span, msg, left)
+	}
+	if (expr.Op == Or && bool(l)) || (expr.Op == And && !bool(l)) {
+		return l, nil
+	}
+
+	right, err := s.evaluate(expr.Right)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := right.(BoolValue)
+	if !ok {
+		return nil, typeError(expr.Span, msg, left, right)
+	}
+	return r, nil
+}
+
+func logicalMessage(op TokenType) string {
+	return fmt.Sprintf("`%s` operands must be boolean", operatorLexeme(op))
+}
+
+func (s Interpreter) evaluateCoalesce(expr BinaryExpr) (Value, error) {
+	left, err := s.evaluate(expr.Left)
+	if err != nil && !isMissing(expr.Left, err) {
+		return nil, err
+	}
+	if err == nil {
+		if _, ok := left.(NullValue); !ok {
+			return left, nil
+		}
+	}
+	return s.evaluate(expr.Right)
+}
+
+// isMissing reports whether err reports a variable, key or index that does not
+// exist along the path of expr, or a value along the path that cannot be
+// indexed, as opposed to an error in a sub-expression, such as an index.
+func isMissing(expr Expr, err error) bool {
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		return false
+	}
+	switch runtimeErr.Kind {
+	case UnknownVariable, UnknownKey, NotAMap, IndexOutOfRange:
+	default:
+		return false
+	}
+
+	return onPath(expr, runtimeErr.Span)
+}
+
+// onPath reports whether span is the span of expr, or of an expression along
+// its path: the target of an index, or the expression in a group.
+func onPath(expr Expr, span Span) bool {
+	for {
+		if SpanOf(expr) == span {
+			return true
+		}
+		switch e := expr.(type) {
+		case IndexExpr:
+			expr = e.Target
+		case GroupExpr:
+			expr = e.Expr
+		default:
+			return false
+		}
 	}
-	panic(fmt.Sprintf("invalid binary operator: %s", expr.Op))
 }
 
 func (s Interpreter) evaluateUnary(expr UnaryExpr) (Value, error) {
-	val, err := s.Evaluate(expr.Expr)
+	val, err := s.evaluate(expr.Expr)
 	if err != nil {
 		return nil, err
 	}
-	switch expr.Op {
+	return s.unary(expr.Op, expr.Span, val)
+}
+
+// unary applies the unary operator op to val.
+func (s Interpreter) unary(op TokenType, span Span, val Value) (Value, error) {
+	switch op {
 	case Not:
 		if val, ok := val.(BoolValue); ok {
 			return !val, nil
 		}
-		return nil, fmt.Errorf("`!` operand must be boolean")
+		return nil, typeError(span, "`!` operand must be boolean", val)
 	case Minus:
 		switch val := val.(type) {
 		case IntValue:
+			if val == math.MinInt64 {
+				return s.overflow(span, op, -DecimalValue(val), val)
+			}
 			return -val, nil
 		case DecimalValue:
 			return -val, nil
 		}
-		return nil, fmt.Errorf("`-` operand must be integer or decimal")
+		return nil, typeError(span, "`-` operand must be integer or decimal", val)
 	}
-	panic(fmt.Sprintf("invalid unary operator: %s", expr.Op))
+	panic(fmt.Sprintf("invalid unary operator: %s", op))
 }
 
 func (s Interpreter) evaluateGroup(expr GroupExpr) (Value, error) {
-	return s.Evaluate(expr.Expr)
+	return s.evaluate(expr.Expr)
 }
 
 func (s Interpreter) evaluateGet(expr GetExpr) (Value, error) {
@@ -324,28 +831,214 @@ func (s Interpreter) evaluateGet(expr GetExpr) (Value, error) {
 		panic("empty get expression")
 	}
 
-	name := expr.Names[0]
-	val, ok := s.variables[name]
+	return lookup(s.env, expr.Names, expr.Span)
+}
+
+// lookup returns the value of the variable at path in env, or an error
+// locating the first name along the path that does not exist.
+func lookup(env Env, path []string, span Span) (Value, error) {
+	if val, ok := env.Lookup(path); ok {
+		return val, nil
+	}
+
+	// Find the longest prefix of the path that exists to report why the rest
+	// does not.
+	for n := len(path) - 1; n > 0; n-- {
+		val, ok := env.Lookup(path[:n])
+		if !ok {
+			continue
+		}
+		name := path[n]
+		if _, ok := val.(MapValue); !ok {
+			return nil, runtimeErrorf(NotAMap, span, "%s is not a map", name)
+		}
+		return nil, runtimeErrorf(UnknownKey, span, "unknown key '%s'", name)
+	}
+	return nil, runtimeErrorf(UnknownVariable, span, "unknown variable '%s'", path[0])
+}
+
+func (s Interpreter) evaluateIndex(expr IndexExpr) (Value, error) {
+	val, _, err := s.evaluateChain(expr)
+	return val, err
+}
+
+// evaluateChain evaluates expr as a link of a chain of postfix operators, as
+// in `a?.b.c[0]`. It reports whether a `?.` along the chain yielded null, in
+// which case the rest of the chain is skipped and yields null too.
+func (s Interpreter) evaluateChain(expr IndexExpr) (Value, bool, error) {
+	target, skipped, err := s.evaluateLink(expr.Target)
+	if err != nil {
+		// A missing target is null to `?.`.
+		if expr.Optional && isMissing(expr.Target, err) {
+			return null, true, nil
+		}
+		return nil, false, err
+	}
+	if skipped {
+		return null, true, nil
+	}
+	index, err := s.evaluate(expr.Index)
+	if err != nil {
+		return nil, false, err
+	}
+
+	val, err := indexValue(expr.Span, target, index)
+	if expr.Optional {
+		if err != nil {
+			return null, true, nil
+		}
+		_, isNull := val.(NullValue)
+		return val, isNull, nil
+	}
+	return val, false, err
+}
+
+// evaluateLink evaluates the target of an index expression, continuing the
+// chain of postfix operators if the target is an index expression too.
+func (s Interpreter) evaluateLink(expr Expr) (Value, bool, error) {
+	link, ok := expr.(IndexExpr)
 	if !ok {
-		return nil, fmt.Errorf("unknown variable '%s'", name)
+		val, err := s.evaluate(expr)
+		return val, false, err
+	}
+	if err := s.eval.step(expr); err != nil {
+		return nil, false, err
 	}
-	for i := 1; i < len(expr.Names); i++ {
-		var obj map[string]any
-		name = expr.Names[i]
-		if obj, ok = val.(map[string]any); !ok {
-			return nil, fmt.Errorf("%s is not a map", name)
+	s.eval.depth++
+	defer func() { s.eval.depth-- }()
+	return s.evaluateChain(link)
+}
+
+func indexValue(span Span, target, index Value) (Value, error) {
+	switch target := target.(type) {
+	case ListValue:
+		i, err := listIndex(span, len(target), index)
+		if err != nil {
+			return nil, err
 		}
-		val, ok = obj[name]
+		return target[i], nil
+	case MapValue:
+		key, ok := index.(StringValue)
 		if !ok {
-			return nil, fmt.Errorf("unknown key '%s'", name)
+			return nil, typeError(span, "map key must be string", index)
 		}
+		val, ok := target[string(key)]
+		if !ok {
+			return nil, runtimeErrorf(UnknownKey, span, "unknown key '%s'", key)
+		}
+		return val, nil
 	}
 
-	if _, ok := val.(map[string]any); ok {
-		return nil, fmt.Errorf("%s is not a primitive value", name)
+	msg := fmt.Sprintf("cannot index %s with %s", typeName(target), typeName(index))
+	if key, ok := index.(StringValue); ok {
+		msg = fmt.Sprintf("cannot index %s with key '%s'", typeName(target), key)
+	}
+	return nil, &RuntimeError{
+		Kind:     NotAMap,
+		Span:     span,
+		Msg:      msg,
+		Operands: operandTypes([]Value{target, index}),
 	}
+}
 
-	return castValue(val), nil
+// listIndex converts index to a position in a list of length n, counting from
+// the end of the list if index is negative.
+func listIndex(span Span, n int, index Value) (int, error) {
+	i, ok := index.(IntValue)
+	if !ok {
+		return 0, typeError(span, "list index must be integer", index)
+	}
+	pos := int(i)
+	if i < 0 {
+		pos += n
+	}
+	if pos < 0 || pos >= n {
+		return 0, runtimeErrorf(
+			IndexOutOfRange,
+			span,
+			"index %d out of range for list of length %d",
+			i,
+			n,
+		)
+	}
+	return pos, nil
+}
+
+func (s Interpreter) evaluateMap(expr MapExpr) (Value, error) {
+	m := make(MapValue, len(expr.Entries))
+	for _, entry := range expr.Entries {
+		val, err := s.evaluate(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		m[entry.Key] = val
+	}
+	return m, nil
+}
+
+func (s Interpreter) evaluateList(expr ListExpr) (Value, error) {
+	list := make(ListValue, len(expr.Elements))
+	for i, element := range expr.Elements {
+		val, err := s.evaluate(element)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = val
+	}
+	return list, nil
+}
+
+func (s Interpreter) evaluateCall(expr CallExpr) (Value, error) {
+	f, ok := s.functions[expr.Name]
+	if !ok {
+		return nil, runtimeErrorf(UnknownFunction, expr.Span, "unknown function '%s'", expr.Name)
+	}
+
+	args := make([]Value, len(expr.Args))
+	for i, arg := range expr.Args {
+		val, err := s.evaluate(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+
+	return s.call(expr.Name, expr.Span, f, args)
+}
+
+// call calls the function f, called name in the source, with args, checking
+// the number of arguments and locating its errors at span.
+func (s Interpreter) call(name string, span Span, f function, args []Value) (Value, error) {
+	if len(args) < f.minArgs || (f.maxArgs >= 0 && len(args) > f.maxArgs) {
+		return nil, runtimeErrorf(
+			ArityMismatch,
+			span,
+			"`%s` expects %s, got %d",
+			name,
+			arityString(f.minArgs, f.maxArgs),
+			len(args),
+		)
+	}
+
+	val, err := f.fn(args)
+	if err != nil {
+		var runtimeErr *RuntimeError
+		if errors.As(err, &runtimeErr) && runtimeErr.Span == (Span{}) {
+			located := *runtimeErr
+			located.Span = span
+			return nil, &located
+		}
+		return nil, &RuntimeError{
+			Kind: CallFailed,
+			Span: span,
+			Msg:  fmt.Sprintf("`%s` failed: %s", name, err),
+			Err:  err,
+		}
+	}
+	if val == nil {
+		return nil, runtimeErrorf(CallFailed, span, "`%s` returned no value", name)
+	}
+	return s.checkString(span, val)
 }
 
 func (s Interpreter) evaluateLiteral(expr LiteralExpr) (Value, error) {
@@ -372,6 +1065,225 @@ func (s Interpreter) evaluateLiteral(expr LiteralExpr) (Value, error) {
 	)
 }
 
+// checkString returns val, or a StringLengthLimit error if val is a string
+// longer than the limit of the interpreter.
+func (s Interpreter) checkString(span Span, val Value) (Value, error) {
+	str, ok := val.(StringValue)
+	if !ok || s.limits.maxStringLength <= 0 || len(str) <= s.limits.maxStringLength {
+		return val, nil
+	}
+	return nil, &LimitError{
+		Kind:  StringLengthLimit,
+		Limit: s.limits.maxStringLength,
+		Span:  span,
+		Msg: fmt.Sprintf(
+			"string of %d bytes exceeds the limit of %d bytes",
+			len(str),
+			s.limits.maxStringLength,
+		),
+	}
+}
+
+func stepError(span Span, maxSteps int) *LimitError {
+	return &LimitError{
+		Kind:  StepLimit,
+		Limit: maxSteps,
+		Span:  span,
+		Msg:   fmt.Sprintf("evaluation exceeded %d steps", maxSteps),
+	}
+}
+
+// interrupted returns an Interrupted error located at span if ctx is done.
+func interrupted(ctx context.Context, span Span) error {
+	err := ctx.Err()
+	if err == nil {
+		return nil
+	}
+	return &LimitError{
+		Kind: Interrupted,
+		Span: span,
+		Msg:  fmt.Sprintf("evaluation interrupted: %s", err),
+		Err:  err,
+	}
+}
+
+// overflow handles an integer operation that overflowed, either by returning
+// the promoted decimal result or an IntegerOverflow error.
+func (s Interpreter) overflow(
+	span Span,
+	op TokenType,
+	promoted DecimalValue,
+	operands ...Value,
+) (Value, error) {
+	if s.promoteOverflow {
+		return promoted, nil
+	}
+	err := runtimeErrorf(IntegerOverflow, span, "integer overflow in `%s`", operatorLexeme(op))
+	err.Operands = operandTypes(operands)
+	return nil, err
+}
+
+func addInt(a, b int64) (int64, bool) {
+	r := a + b
+	return r, (a^r)&(b^r) >= 0
+}
+
+func subInt(a, b int64) (int64, bool) {
+	r := a - b
+	return r, (a^b)&(a^r) >= 0
+}
+
+func mulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	r := a * b
+	return r, r/b == a && !(b == -1 && a == math.MinInt64)
+}
+
+func arityString(minArgs, maxArgs int) string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case minArgs == maxArgs:
+		return plural(minArgs)
+	case maxArgs < 0:
+		return "at least " + plural(minArgs)
+	}
+	return fmt.Sprintf("%d to %s", minArgs, plural(maxArgs))
+}
+
+// powInt raises base to a non-negative exponent by repeated squaring.
+func powInt(base, exp int64) (int64, bool) {
+	result := int64(1)
+	for exp > 0 {
+		var ok bool
+		if exp&1 == 1 {
+			result, ok = mulInt(result, base)
+			if !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		if exp > 0 {
+			base, ok = mulInt(base, base)
+			if !ok {
+				return 0, false
+			}
+		}
+	}
+	return result, true
+}
+
+// valuesEqual reports whether a and b are equal, comparing integers and
+// decimals by value and lists and maps element by element. Values of
+// incompatible types are not equal.
+func valuesEqual(a, b Value) bool {
+	switch a := a.(type) {
+	case IntValue:
+		switch b := b.(type) {
+		case IntValue:
+			return a == b
+		case DecimalValue:
+			return DecimalValue(a) == b
+		}
+	case DecimalValue:
+		switch b := b.(type) {
+		case IntValue:
+			return a == DecimalValue(b)
+		case DecimalValue:
+			return a == b
+		}
+	case ListValue:
+		b, ok := b.(ListValue)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !valuesEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case MapValue:
+		b, ok := b.(MapValue)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !valuesEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	default:
+		// Values implemented outside the package may not be comparable, and
+		// comparing them with == would panic.
+		if a != nil && !reflect.TypeOf(a).Comparable() {
+			return false
+		}
+		return a == b
+	}
+	return false
+}
+
+// numberOrStringError reports operands of an operator that accepts either two
+// numbers or two strings.
+func numberOrStringError(op TokenType, span Span, left, right Value) *RuntimeError {
+	_, leftIsString := left.(StringValue)
+	_, rightIsString := right.(StringValue)
+	if leftIsString != rightIsString {
+		return typeError(
+			span,
+			fmt.Sprintf(
+				"`%s` cannot mix string and non-string operands: %s and %s",
+				operatorLexeme(op),
+				typeName(left),
+				typeName(right),
+			),
+			left,
+			right,
+		)
+	}
+	return typeError(
+		span,
+		fmt.Sprintf(
+			"`%s` operands must be both numbers or both strings: %s and %s",
+			operatorLexeme(op),
+			typeName(left),
+			typeName(right),
+		),
+		left,
+		right,
+	)
+}
+
+func runtimeErrorf(kind RuntimeErrorKind, span Span, format string, args ...any) *RuntimeError {
+	return &RuntimeError{Kind: kind, Span: span, Msg: fmt.Sprintf(format, args...)}
+}
+
+func typeError(span Span, msg string, operands ...Value) *RuntimeError {
+	return &RuntimeError{
+		Kind:     TypeMismatch,
+		Span:     span,
+		Msg:      msg,
+		Operands: operandTypes(operands),
+	}
+}
+
+func operandTypes(operands []Value) []string {
+	names := make([]string, len(operands))
+	for i, v := range operands {
+		names[i] = typeName(v)
+	}
+	return names
+}
+
 func checkBinary[L, R Value](left, right Value) (L, R, bool) {
 	var zeroL L
 	var zeroR R
@@ -386,38 +1298,25 @@ func checkBinary[L, R Value](left, right Value) (L, R, bool) {
 	return leftL, rightR, true
 }
 
-func castValue(v any) Value {
-	switch v := v.(type) {
-	case bool:
-		return BoolValue(v)
-	case int64:
-		return IntValue(v)
-	case float64:
-		return DecimalValue(v)
-	case string:
-		return StringValue(v)
-	case nil, NullValue:
-		return null
-	case Value:
-		return v
-	}
-	panic(fmt.Sprintf("invalid value type: %T", v))
-}
-
-func typeName(v any) string {
+func typeName(v Value) string {
 	switch v.(type) {
-	case bool, BoolValue:
+	case BoolValue:
 		return "boolean"
-	case int64, IntValue:
+	case IntValue:
 		return "integer"
-	case float64, DecimalValue:
+	case DecimalValue:
 		return "decimal"
-	case string, StringValue:
+	case StringValue:
 		return "string"
-	case map[string]any:
+	case ListValue:
+		return "list"
+	case MapValue:
 		return "map"
-	case nil, NullValue:
+	case NullValue:
 		return "null"
+	case nil:
+		return "nil"
 	}
-	panic(fmt.Sprintf("invalid type: %T", v))
+	// Values implemented outside the package are named after their Go type.
+	return fmt.Sprintf("%T", v)
 }
@@ -1,7 +1,9 @@
 package pock
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"slices"
 	"strings"
 	"testing"
@@ -10,150 +12,460 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestInterpreter(t *testing.T) {
-	type testCase struct {
-		state    map[string]any
-		input    string
-		expected any
-	}
-	cases := []testCase{
-		{input: "true", expected: true},
-		{input: "false", expected: false},
-		{input: "null", expected: null},
-		{input: "3", expected: 3},
-		{input: "3.14", expected: 3.14},
-		{input: `"Hello World!"`, expected: "Hello World!"},
-		{input: "1138 <= 1138", expected: true},
-		{input: "1138.0 <= 1138", expected: true},
-		{input: "1138 <= 1138.0", expected: true},
-		{input: "1138.0 <= 1138.0", expected: true},
-		{input: "1138 <= 9999999", expected: true},
-		{input: "1138.0 <= 9999999", expected: true},
-		{input: "1138 <= 9999999.0", expected: true},
-		{input: "1138.0 <= 9999999.0", expected: true},
-		{input: "1138 <= 0", expected: false},
-		{input: "1138.0 <= 0", expected: false},
-		{input: "1138 <= 0.0", expected: false},
-		{input: "1138.0 <= 0.0", expected: false},
-		{input: "1138 < 1138", expected: false},
-		{input: "1138.0 < 1138", expected: false},
-		{input: "1138 < 1138.0", expected: false},
-		{input: "1138.0 < 1138.0", expected: false},
-		{input: "1138 < 9999999", expected: true},
-		{input: "1138.0 < 9999999", expected: true},
-		{input: "1138 < 9999999.0", expected: true},
-		{input: "1138.0 < 9999999.0", expected: true},
-		{input: "1138 < 0", expected: false},
-		{input: "1138.0 < 0", expected: false},
-		{input: "1138 < 0.0", expected: false},
-		{input: "1138.0 < 0.0", expected: false},
-		{input: "1138 >= 1138", expected: true},
-		{input: "1138.0 >= 1138", expected: true},
-		{input: "1138 >= 1138.0", expected: true},
-		{input: "1138.0 >= 1138.0", expected: true},
-		{input: "1138 >= 9999999", expected: false},
-		{input: "1138.0 >= 9999999", expected: false},
-		{input: "1138 >= 9999999.0", expected: false},
-		{input: "1138.0 >= 9999999.0", expected: false},
-		{input: "1138 >= 0", expected: true},
-		{input: "1138.0 >= 0", expected: true},
-		{input: "1138 >= 0.0", expected: true},
-		{input: "1138.0 >= 0.0", expected: true},
-		{input: "1138 > 1138", expected: false},
-		{input: "1138.0 > 1138", expected: false},
-		{input: "1138 > 1138.0", expected: false},
-		{input: "1138.0 > 1138.0", expected: false},
-		{input: "1138 > 9999999", expected: false},
-		{input: "1138.0 > 9999999", expected: false},
-		{input: "1138 > 9999999.0", expected: false},
-		{input: "1138.0 > 9999999.0", expected: false},
-		{input: "1138 > 0", expected: true},
-		{input: "1138.0 > 0", expected: true},
-		{input: "1138 > 0.0", expected: true},
-		{input: "1138.0 > 0.0", expected: true},
-		{input: "1138 == 1138", expected: true},
-		{input: "1138.0 == 1138", expected: true},
-		{input: "1138 == 1138.0", expected: true},
-		{input: "1138.0 == 1138.0", expected: true},
-		{input: "1138 == 0", expected: false},
-		{input: "1138.0 == 0", expected: false},
-		{input: "1138 == 0.0", expected: false},
-		{input: "1138.0 == 0.0", expected: false},
-		{input: `"hello" == "hello"`, expected: true},
-		{input: `"hello" == "world"`, expected: false},
-		{input: "true == true", expected: true},
-		{input: "true == false", expected: false},
-		{input: "false == true", expected: false},
-		{input: "false == false", expected: true},
-		{input: "null == null", expected: true},
-		{input: "1138 != 1138", expected: false},
-		{input: "1138.0 != 1138", expected: false},
-		{input: "1138 != 1138.0", expected: false},
-		{input: "1138.0 != 1138.0", expected: false},
-		{input: "1138 != 0", expected: true},
-		{input: "1138.0 != 0", expected: true},
-		{input: "1138 != 0.0", expected: true},
-		{input: "1138.0 != 0.0", expected: true},
-		{input: `"hello" != "hello"`, expected: false},
-		{input: `"hello" != "world"`, expected: true},
-		{input: "true != true", expected: false},
-		{input: "true != false", expected: true},
-		{input: "false != true", expected: true},
-		{input: "false != false", expected: false},
-		{input: "null != null", expected: false},
-		{input: "-1138", expected: -1138},
-		{input: "-1138.0", expected: -1138.0},
-		{input: "!true", expected: false},
-		{input: "!false", expected: true},
-		{input: "1138 + 10", expected: 1148},
-		{input: "1138.0 + 10", expected: 1148.0},
-		{input: "1138 + 10.0", expected: 1148.0},
-		{input: "1138.0 + 10.0", expected: 1148.0},
-		{input: "1138 - 10", expected: 1128},
-		{input: "1138.0 - 10", expected: 1128.0},
-		{input: "1138 - 10.0", expected: 1128.0},
-		{input: "1138.0 - 10.0", expected: 1128.0},
-		{input: "1138 * 10", expected: 11380},
-		{input: "1138.0 * 10", expected: 11380.0},
-		{input: "1138 * 10.0", expected: 11380.0},
-		{input: "1138.0 * 10.0", expected: 11380.0},
-		{input: "1138 / 10", expected: 113},
-		{input: "1138.0 / 10", expected: 113.8},
-		{input: "1138 / 10.0", expected: 113.8},
-		{input: "1138.0 / 10.0", expected: 113.8},
-		{input: "false && false", expected: false},
-		{input: "false && true", expected: false},
-		{input: "true && false", expected: false},
-		{input: "true && true", expected: true},
-		{input: "false || false", expected: false},
-		{input: "false || true", expected: true},
-		{input: "true || false", expected: true},
-		{input: "true || true", expected: true},
-		{input: "(1 == 2) == false", expected: true},
-		{
-			state:    map[string]any{"hello": "world"},
-			input:    "hello",
-			expected: "world",
-		},
-		{
-			state:    map[string]any{"hello": map[string]any{"world": 1138}},
-			input:    "hello.world",
-			expected: 1138,
-		},
-		{
-			state: map[string]any{
-				"hello": map[string]any{
-					"world": "Hello World!",
-				},
-				"THX": 1138,
+type interpreterTestCase struct {
+	state    map[string]any
+	input    string
+	expected any
+}
+
+// interpreterCases are shared with the tests and benchmarks of the VM.
+var interpreterCases = []interpreterTestCase{
+	{input: "true", expected: true},
+	{input: "false", expected: false},
+	{input: "null", expected: null},
+	{input: "3", expected: 3},
+	{input: "3.14", expected: 3.14},
+	{input: `"Hello World!"`, expected: "Hello World!"},
+	{input: "1138 <= 1138", expected: true},
+	{input: "1138.0 <= 1138", expected: true},
+	{input: "1138 <= 1138.0", expected: true},
+	{input: "1138.0 <= 1138.0", expected: true},
+	{input: "1138 <= 9999999", expected: true},
+	{input: "1138.0 <= 9999999", expected: true},
+	{input: "1138 <= 9999999.0", expected: true},
+	{input: "1138.0 <= 9999999.0", expected: true},
+	{input: "1138 <= 0", expected: false},
+	{input: "1138.0 <= 0", expected: false},
+	{input: "1138 <= 0.0", expected: false},
+	{input: "1138.0 <= 0.0", expected: false},
+	{input: "1138 < 1138", expected: false},
+	{input: "1138.0 < 1138", expected: false},
+	{input: "1138 < 1138.0", expected: false},
+	{input: "1138.0 < 1138.0", expected: false},
+	{input: "1138 < 9999999", expected: true},
+	{input: "1138.0 < 9999999", expected: true},
+	{input: "1138 < 9999999.0", expected: true},
+	{input: "1138.0 < 9999999.0", expected: true},
+	{input: "1138 < 0", expected: false},
+	{input: "1138.0 < 0", expected: false},
+	{input: "1138 < 0.0", expected: false},
+	{input: "1138.0 < 0.0", expected: false},
+	{input: "1138 >= 1138", expected: true},
+	{input: "1138.0 >= 1138", expected: true},
+	{input: "1138 >= 1138.0", expected: true},
+	{input: "1138.0 >= 1138.0", expected: true},
+	{input: "1138 >= 9999999", expected: false},
+	{input: "1138.0 >= 9999999", expected: false},
+	{input: "1138 >= 9999999.0", expected: false},
+	{input: "1138.0 >= 9999999.0", expected: false},
+	{input: "1138 >= 0", expected: true},
+	{input: "1138.0 >= 0", expected: true},
+	{input: "1138 >= 0.0", expected: true},
+	{input: "1138.0 >= 0.0", expected: true},
+	{input: "1138 > 1138", expected: false},
+	{input: "1138.0 > 1138", expected: false},
+	{input: "1138 > 1138.0", expected: false},
+	{input: "1138.0 > 1138.0", expected: false},
+	{input: "1138 > 9999999", expected: false},
+	{input: "1138.0 > 9999999", expected: false},
+	{input: "1138 > 9999999.0", expected: false},
+	{input: "1138.0 > 9999999.0", expected: false},
+	{input: "1138 > 0", expected: true},
+	{input: "1138.0 > 0", expected: true},
+	{input: "1138 > 0.0", expected: true},
+	{input: "1138.0 > 0.0", expected: true},
+	{input: "1138 == 1138", expected: true},
+	{input: "1138.0 == 1138", expected: true},
+	{input: "1138 == 1138.0", expected: true},
+	{input: "1138.0 == 1138.0", expected: true},
+	{input: "1138 == 0", expected: false},
+	{input: "1138.0 == 0", expected: false},
+	{input: "1138 == 0.0", expected: false},
+	{input: "1138.0 == 0.0", expected: false},
+	{input: `"hello" == "hello"`, expected: true},
+	{input: `"hello" == "world"`, expected: false},
+	{input: "true == true", expected: true},
+	{input: "true == false", expected: false},
+	{input: "false == true", expected: false},
+	{input: "false == false", expected: true},
+	{input: "null == null", expected: true},
+	{input: "1138 != 1138", expected: false},
+	{input: "1138.0 != 1138", expected: false},
+	{input: "1138 != 1138.0", expected: false},
+	{input: "1138.0 != 1138.0", expected: false},
+	{input: "1138 != 0", expected: true},
+	{input: "1138.0 != 0", expected: true},
+	{input: "1138 != 0.0", expected: true},
+	{input: "1138.0 != 0.0", expected: true},
+	{input: `"hello" != "hello"`, expected: false},
+	{input: `"hello" != "world"`, expected: true},
+	{input: `"hello" + "world"`, expected: "helloworld"},
+	{input: `"hello" + " " + "world"`, expected: "hello world"},
+	{input: `"" + ""`, expected: ""},
+	{input: `'single' + "double" + ` + "`raw`", expected: "singledoubleraw"},
+	{input: `"say \"hi\"" == 'say "hi"'`, expected: true},
+	{input: `"\u00e9" == "é"`, expected: true},
+	{input: "0xFF + 1_000", expected: 1255},
+	{input: "0b1010 * 0o10", expected: 80},
+	{input: ".5 * 4", expected: 2.0},
+	{input: "1e3 == 1000", expected: true},
+	{input: "[1, .5][1]", expected: 0.5},
+	{input: "1 + // one\n2 /* two */ * 3", expected: 7},
+	{input: "{\n  \"a\": 1, // first\n  \"b\": 2\n}.b", expected: 2},
+	{input: `"abc" < "abd"`, expected: true},
+	{input: `"abc" < "abc"`, expected: false},
+	{input: `"abc" <= "abc"`, expected: true},
+	{input: `"b" > "abc"`, expected: true},
+	{input: `"v1.10" >= "v1.9"`, expected: false},
+	{
+		state:    map[string]any{"first": "Ada", "last": "Lovelace"},
+		input:    `first + " " + last`,
+		expected: "Ada Lovelace",
+	},
+	{input: "true != true", expected: false},
+	{input: "true != false", expected: true},
+	{input: "false != true", expected: true},
+	{input: "false != false", expected: false},
+	{input: "null != null", expected: false},
+	{input: "-1138", expected: -1138},
+	{input: "-1138.0", expected: -1138.0},
+	{input: "!true", expected: false},
+	{input: "!false", expected: true},
+	{input: "!!true", expected: true},
+	{input: "!!!true", expected: false},
+	{input: "--1138", expected: 1138},
+	{input: "- -1138.0", expected: 1138.0},
+	{input: "-(-1138)", expected: 1138},
+	{input: "---1138", expected: -1138},
+	{input: "-1 * -2", expected: 2},
+	{input: "!(1 < 2) == !!false", expected: true},
+	{input: "1138 + 10", expected: 1148},
+	{input: "1138.0 + 10", expected: 1148.0},
+	{input: "1138 + 10.0", expected: 1148.0},
+	{input: "1138.0 + 10.0", expected: 1148.0},
+	{input: "1138 - 10", expected: 1128},
+	{input: "1138.0 - 10", expected: 1128.0},
+	{input: "1138 - 10.0", expected: 1128.0},
+	{input: "1138.0 - 10.0", expected: 1128.0},
+	{input: "1138 * 10", expected: 11380},
+	{input: "1138.0 * 10", expected: 11380.0},
+	{input: "1138 * 10.0", expected: 11380.0},
+	{input: "1138.0 * 10.0", expected: 11380.0},
+	{input: "1138 / 10", expected: 113},
+	{input: "1138.0 / 10", expected: 113.8},
+	{input: "1138 / 10.0", expected: 113.8},
+	{input: "1138.0 / 10.0", expected: 113.8},
+	{input: "1138.0 / 0", expected: math.Inf(1)},
+	{input: "-7 / 2", expected: -3},
+	{input: "1138 % 10", expected: 8},
+	{input: "-7 % 3", expected: -1},
+	{input: "7.5 % 2", expected: 1.5},
+	{input: "7 % 2.5", expected: 2.0},
+	{input: "7.5 % 2.5", expected: 0.0},
+	{input: "2 ** 10", expected: 1024},
+	{input: "2 ** 3 ** 2", expected: 512},
+	{input: "(2 ** 3) ** 2", expected: 64},
+	{input: "-2 ** 2", expected: -4},
+	{input: "(-2) ** 3", expected: -8},
+	{input: "2 ** -1", expected: 0.5},
+	{input: "0 ** 0", expected: 1},
+	{input: "4 ** 0.5", expected: 2.0},
+	{input: "1.5 ** 2", expected: 2.25},
+	{input: "1 + 2 * 3 ** 2 % 5", expected: 4},
+	{input: "1000.0 * (1 + 0.05) ** 2", expected: 1102.5},
+	{
+		state:    map[string]any{"max": math.MaxInt64, "min": math.MinInt64},
+		input:    "max + min",
+		expected: -1,
+	},
+	{
+		state:    map[string]any{"max": math.MaxInt64, "min": math.MinInt64},
+		input:    "-max - 1 == min",
+		expected: true,
+	},
+	{input: "-9223372036854775807 - 1", expected: math.MinInt64},
+	{input: "(-2) ** 63", expected: math.MinInt64},
+	{input: "-2 ** 2", expected: -4},
+	{input: "false && false", expected: false},
+	{input: "false && true", expected: false},
+	{input: "true && false", expected: false},
+	{input: "true && true", expected: true},
+	{input: "false || false", expected: false},
+	{input: "false || true", expected: true},
+	{input: "true || false", expected: true},
+	{input: "true || true", expected: true},
+	{input: "(1 == 2) == false", expected: true},
+	{input: "true || missing", expected: true},
+	{input: "false && missing", expected: false},
+	{input: "true || 1", expected: true},
+	{input: "false && 1", expected: false},
+	{
+		state:    map[string]any{"has_profile": false},
+		input:    "has_profile && profile.age > 18",
+		expected: false,
+	},
+	{
+		state:    map[string]any{"user": map[string]any{"vip": true}},
+		input:    "user.vip || missing.key",
+		expected: true,
+	},
+	{input: "true ? 1 : 2", expected: 1},
+	{input: "false ?.5 : .25", expected: 0.25},
+	{input: "false ? 1 : 2", expected: 2},
+	{input: "1 < 2 ? \"yes\" : \"no\"", expected: "yes"},
+	{input: "false ? 1 : true ? 2 : 3", expected: 2},
+	{input: "true ? false ? 1 : 2 : 3", expected: 2},
+	{input: "true ? 1 : missing", expected: 1},
+	{input: "false ? 1 / 0 : 0", expected: 0},
+	{input: "(true ? 1 : 2) + 10", expected: 11},
+	{
+		state:    map[string]any{"premium": true},
+		input:    "1000 * (premium ? 0.1 : 0.05)",
+		expected: 100.0,
+	},
+	{input: "[]", expected: ListValue{}},
+	{input: "[1, 2.5, \"three\", true, null]", expected: ListValue{IntValue(1), DecimalValue(2.5), StringValue("three"), BoolValue(true), null}},
+	{input: "[1 + 1, [2]]", expected: ListValue{IntValue(2), ListValue{IntValue(2)}}},
+	{input: "[1, 2, 3][0]", expected: 1},
+	{input: "[1, 2, 3][2]", expected: 3},
+	{input: "[1, 2, 3][-1]", expected: 3},
+	{input: "[1, 2, 3][-3]", expected: 1},
+	{input: "[[1, 2], [3, 4]][1][0]", expected: 3},
+	{input: "len([1, 2, 3])", expected: 3},
+	{
+		state:    map[string]any{"xs": []any{1, 2.5, "three"}},
+		input:    "xs",
+		expected: ListValue{IntValue(1), DecimalValue(2.5), StringValue("three")},
+	},
+	{
+		state:    map[string]any{"xs": []any{1, 2.5, "three"}},
+		input:    "xs[1]",
+		expected: 2.5,
+	},
+	{
+		state:    map[string]any{"xs": []int{10, 20, 30}},
+		input:    "xs[len(xs) - 1] + xs[-2]",
+		expected: 50,
+	},
+	{
+		state: map[string]any{"users": []any{
+			map[string]any{"name": "Ada", "tags": []string{"math", "computing"}},
+			map[string]any{"name": "Grace"},
+		}},
+		input:    `users[0].name + " & " + users[-1].name`,
+		expected: "Ada & Grace",
+	},
+	{
+		state: map[string]any{"users": []any{
+			map[string]any{"name": "Ada", "tags": []string{"math", "computing"}},
+		}},
+		input:    "users[0].tags[-1]",
+		expected: "computing",
+	},
+	{
+		state:    map[string]any{"hello": map[string]any{"matrix": []any{[]any{1, 2}, []any{3, 4}}}},
+		input:    "hello.matrix[1][1]",
+		expected: 4,
+	},
+	{input: "{}", expected: MapValue{}},
+	{
+		input:    `{"a": 1, "b-c": [true], "d": {"e": null}}`,
+		expected: MapValue{"a": IntValue(1), "b-c": ListValue{BoolValue(true)}, "d": MapValue{"e": null}},
+	},
+	{input: `{"a": 1 + 1}["a"]`, expected: 2},
+	{input: `{"a": {"b": [1, 2]}}.a.b[-1]`, expected: 2},
+	{input: `len({"a": 1, "b": 2})`, expected: 2},
+	{
+		state:    map[string]any{"hello": map[string]any{}},
+		input:    "hello",
+		expected: MapValue{},
+	},
+	{
+		state:    map[string]any{"hello": map[string]any{"world": 1138}},
+		input:    "hello",
+		expected: MapValue{"world": IntValue(1138)},
+	},
+	{
+		state:    map[string]any{"xs": []any{map[string]any{}}},
+		input:    "xs",
+		expected: ListValue{MapValue{}},
+	},
+	{
+		state: map[string]any{"headers": map[string]any{
+			"content-type": "application/json",
+			"x.forwarded":  "yes",
+			"with space":   "ok",
+		}},
+		input:    `headers["content-type"] + " " + headers["x.forwarded"] + " " + headers["with space"]`,
+		expected: "application/json yes ok",
+	},
+	{
+		state:    map[string]any{"hello": map[string]any{"world": 1138}, "key": "world"},
+		input:    "hello[key]",
+		expected: 1138,
+	},
+	{input: "1 in [1, 2, 3]", expected: true},
+	{input: "4 in [1, 2, 3]", expected: false},
+	{input: "1.0 in [1, 2, 3]", expected: true},
+	{input: `"1" in [1, 2, 3]`, expected: false},
+	{input: "null in [1, null]", expected: true},
+	{input: "[1] in [[1], [2]]", expected: true},
+	{input: `{"a": 1} in [{"a": 1.0}]`, expected: true},
+	{input: "1 in []", expected: false},
+	{input: "1 not in [1, 2, 3]", expected: false},
+	{input: "4 not in [1, 2, 3]", expected: true},
+	{input: `"a" in {"a": 1}`, expected: true},
+	{input: `"b" in {"a": 1}`, expected: false},
+	{input: `"b" not in {"a": 1}`, expected: true},
+	{input: `"ell" in "hello"`, expected: true},
+	{input: `"" in "hello"`, expected: true},
+	{input: `"world" in "hello"`, expected: false},
+	{input: `"world" not in "hello"`, expected: true},
+	{input: `1 + 1 in [2]`, expected: true},
+	{
+		state:    map[string]any{"country": "FR", "not": true},
+		input:    `country in ["FR", "DE"] && not`,
+		expected: true,
+	},
+	{
+		state:    map[string]any{"a": map[string]any{"b": map[string]any{"c": 1}}},
+		input:    "a?.b?.c",
+		expected: 1,
+	},
+	{
+		state:    map[string]any{"a": map[string]any{"b": map[string]any{}}},
+		input:    "a?.b?.c",
+		expected: null,
+	},
+	{
+		state:    map[string]any{"a": map[string]any{}},
+		input:    "a?.b?.c",
+		expected: null,
+	},
+	{
+		state:    map[string]any{"a": map[string]any{"b": 12}},
+		input:    "a?.b?.c",
+		expected: null,
+	},
+	{
+		state:    map[string]any{"a": nil},
+		input:    "a?.b",
+		expected: null,
+	},
+	{
+		state:    map[string]any{"a": []any{1, 2}},
+		input:    "a?.[5] == null && a?.[1] == 2",
+		expected: true,
+	},
+	{input: "missing?.b", expected: null},
+	{input: "missing?.b.c", expected: null},
+	{
+		state:    map[string]any{"x": map[string]any{"a": nil}},
+		input:    "x?.a.b",
+		expected: null,
+	},
+	{
+		state:    map[string]any{"x": map[string]any{"a": nil}},
+		input:    "x?.a[0]",
+		expected: null,
+	},
+	{
+		state:    map[string]any{"x": nil},
+		input:    "x?.a[0].b ?? 1",
+		expected: 1,
+	},
+	{
+		state:    map[string]any{"x": map[string]any{"a": []any{map[string]any{"b": 2}}}},
+		input:    "x?.a[0].b",
+		expected: 2,
+	},
+	{
+		state:    map[string]any{"a": map[string]any{}},
+		input:    "a?.b.c",
+		expected: null,
+	},
+	{
+		state:    map[string]any{"a": map[string]any{"b": nil}},
+		input:    "a?.b?.c.d",
+		expected: null,
+	},
+	{input: "missing?.[0] ?? 1", expected: 1},
+	{
+		state:    map[string]any{"a": map[string]any{}},
+		input:    "a.b?.c",
+		expected: null,
+	},
+	{
+		state:    map[string]any{"a": []any{1, 2}},
+		input:    "a[5]?.b",
+		expected: null,
+	},
+	{input: "null ?? 1", expected: 1},
+	{input: "0 ?? 1", expected: 0},
+	{input: "false ?? true", expected: false},
+	{input: "missing ?? 1", expected: 1},
+	{input: "missing ?? null ?? 2", expected: 2},
+	{input: "1 ?? missing", expected: 1},
+	{input: "[1][3] ?? 2", expected: 2},
+	{input: `{"a": 1}.b ?? 2`, expected: 2},
+	{input: `({"a": 1}["b"]) ?? 2`, expected: 2},
+	{
+		state:    map[string]any{"user": map[string]any{"profile": map[string]any{}}},
+		input:    `user.profile.nickname ?? user.profile?.name ?? "anonymous"`,
+		expected: "anonymous",
+	},
+	{
+		state:    map[string]any{"a": map[string]any{"b": map[string]any{"c": 3}}},
+		input:    `a.b.c ?? 0`,
+		expected: 3,
+	},
+	{state: map[string]any{"a": 1}, input: "a.b ?? 2", expected: 2},
+	{
+		state:    map[string]any{"a": map[string]any{"b": nil}},
+		input:    "a.b.c ?? 4",
+		expected: 4,
+	},
+	{
+		state:    map[string]any{"a": map[string]any{"b": "str"}},
+		input:    "a.b.c ?? 4",
+		expected: 4,
+	},
+	{
+		state:    map[string]any{"a": []any{nil, 1}},
+		input:    "(a[0].c ?? 4) + (a[1][0] ?? 5)",
+		expected: 9,
+	},
+	{input: `"hello"[0] ?? 6`, expected: 6},
+	{input: "1 + 2 + 3", expected: 6},
+	{input: "10 - 2 - 3", expected: 5},
+	{input: "100 / 10 / 5", expected: 2},
+	{input: "2 * 3 * 4.0", expected: 24.0},
+	{input: "1 + 2 * 3 - 4 / 2 + 6", expected: 11},
+	{
+		state:    map[string]any{"hello": "world"},
+		input:    "hello",
+		expected: "world",
+	},
+	{
+		state:    map[string]any{"hello": map[string]any{"world": 1138}},
+		input:    "hello.world",
+		expected: 1138,
+	},
+	{
+		state: map[string]any{
+			"hello": map[string]any{
+				"world": "Hello World!",
 			},
-			input:    `(THX - 1 == 2) || (hello.world == "Hello World!")`,
-			expected: true,
+			"THX": 1138,
 		},
-	}
+		input:    `(THX - 1 == 2) || (hello.world == "Hello World!")`,
+		expected: true,
+	},
+}
 
+func TestInterpreter(t *testing.T) {
 	t.Parallel()
-	for _, c := range cases {
+	for _, c := range interpreterCases {
 		t.Run(c.input, func(t *testing.T) {
 			tokens, err := Scan(strings.NewReader(c.input))
 			require.NoError(t, err)
@@ -173,36 +485,90 @@ func TestInterpreter(t *testing.T) {
 	}
 }
 
-func TestInterpreterError(t *testing.T) {
-	type testCase struct {
-		state map[string]any
-		input string
-	}
-	cases := []testCase{
-		{input: "1 || 0"},
-		{input: `1 && "hello"`},
-		{input: `"hello" <3`},
-		{input: `"hello" <=3`},
-		{input: `"hello" > 3`},
-		{input: `"hello" >= 3`},
-		{input: `1 == "hello"`},
-		{input: `1 != "hello"`},
-		{input: `"hello" + "world"`},
-		{input: `"hello" - "world"`},
-		{input: `"hello" * "world"`},
-		{input: `"hello" / "world"`},
-		{input: "!1"},
-		{input: "-true"},
-		{input: "-true"},
-		{input: "hello"},
-		{state: map[string]any{"hello": true}, input: "world"},
-		{state: map[string]any{"hello": true}, input: "hello.world"},
-		{state: map[string]any{"hello": map[string]any{}}, input: "hello"},
-		{state: map[string]any{"hello": map[string]any{}}, input: "hello.world"},
-	}
+type interpreterErrorTestCase struct {
+	state map[string]any
+	input string
+}
+
+var interpreterErrorCases = []interpreterErrorTestCase{
+	{input: "1 || 0"},
+	{input: `1 && "hello"`},
+	{input: "false || missing"},
+	{input: "true && missing"},
+	{input: "false || 1"},
+	{input: "true && 1"},
+	{input: `"hello" <3`},
+	{input: `"hello" <=3`},
+	{input: `"hello" > 3`},
+	{input: `"hello" >= 3`},
+	{input: `1 == "hello"`},
+	{input: `1 != "hello"`},
+	{input: `"hello" + 1`},
+	{input: `1.0 + "world"`},
+	{input: `true + false`},
+	{input: `"hello" < 1`},
+	{input: `null >= null`},
+	{input: `"hello" - "world"`},
+	{input: `"hello" * "world"`},
+	{input: `"hello" / "world"`},
+	{input: "1 / 0"},
+	{input: "1138 / (2 - 2)"},
+	{state: map[string]any{"max": math.MaxInt64}, input: "max + 1"},
+	{state: map[string]any{"min": math.MinInt64}, input: "min - 1"},
+	{state: map[string]any{"max": math.MaxInt64}, input: "max * 2"},
+	{state: map[string]any{"min": math.MinInt64}, input: "min * -1"},
+	{state: map[string]any{"min": math.MinInt64}, input: "-min"},
+	{state: map[string]any{"min": math.MinInt64}, input: "min / -1"},
+	{input: "1 % 0"},
+	{input: `"hello" % 2`},
+	{input: `2 ** "hello"`},
+	{input: "2 ** 63"},
+	{input: "-2 ** 63"},
+	{input: "(-2) ** 64"},
+	{input: "10 ** 19"},
+	{input: "1 ? 2 : 3"},
+	{input: "null ? 2 : 3"},
+	{input: "true ? missing : 3"},
+	{input: "[1, 2][2]"},
+	{input: "[1, 2][-3]"},
+	{input: `[1, 2]["a"]`},
+	{input: "[1, 2][1.0]"},
+	{input: "1[0]"},
+	{input: `"hello"[0]`},
+	{input: "[1, 2] + [3]"},
+	{state: map[string]any{"xs": []any{map[string]any{}}}, input: "xs[0].name"},
+	{state: map[string]any{"xs": []any{1}}, input: "xs[0].name"},
+	{input: `{"a": 1}["b"]`},
+	{input: `{"a": 1}[0]`},
+	{input: `{"a": 1}.b`},
+	{input: `{"a": 1} + {"b": 2}`},
+	{input: "1 in 1"},
+	{input: "1 not in null"},
+	{input: `1 in {"a": 1}`},
+	{input: `1 in "hello"`},
+	{input: "(missing + 1) ?? 2"},
+	{input: "[1][missing] ?? 2"},
+	{input: `[1]["a"] ?? 2`},
+	{input: `{"a": 1}[0] ?? 2`},
+	{input: "null ?? missing"},
+	{state: map[string]any{"a": map[string]any{"b": map[string]any{"c": nil}}}, input: "a?.b.c.d"},
+	{state: map[string]any{"a": map[string]any{}}, input: "(a?.b).c"},
+	{state: map[string]any{"a": []any{1, 2}}, input: "a[missing]?.b"},
+	{input: "!1"},
+	{input: "-true"},
+	{input: "-true"},
+	{input: "!-1"},
+	{input: "-!true"},
+	{input: "!-1.0"},
+	{input: "hello"},
+	{state: map[string]any{"hello": true}, input: "world"},
+	{state: map[string]any{"hello": true}, input: "hello.world"},
+	{state: map[string]any{"hello": map[string]any{}}, input: "hello.world"},
+}
 
+func TestInterpreterError(t *testing.T) {
 	t.Parallel()
-	for _, c := range cases {
+	for _, c := range interpreterErrorCases {
 		t.Run(c.input, func(t *testing.T) {
 			tokens, err := Scan(strings.NewReader(c.input))
 			require.NoError(t, err)
@@ -222,6 +588,165 @@ func TestInterpreterError(t *testing.T) {
 	}
 }
 
+func TestInterpreterOverflowPromotion(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected any
+	}
+	cases := []testCase{
+		{input: "max + 1", expected: float64(math.MaxInt64) + 1},
+		{input: "min - 1", expected: float64(math.MinInt64) - 1},
+		{input: "max * 2", expected: float64(math.MaxInt64) * 2},
+		{input: "-min", expected: -float64(math.MinInt64)},
+		{input: "min / -1", expected: -float64(math.MinInt64)},
+		{input: "2 ** 64", expected: math.Pow(2, 64)},
+		{input: "-2 ** 63", expected: -math.Pow(2, 63)},
+		{input: "max - 1", expected: math.MaxInt64 - 1},
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			i, err := NewInterpreterWithState(
+				map[string]any{"max": math.MaxInt64, "min": math.MinInt64},
+				WithOverflowPromotion(),
+			)
+			require.NoError(t, err)
+			val, err := i.Evaluate(expr)
+			require.NoError(t, err)
+			require.EqualValues(t, c.expected, val)
+		})
+	}
+}
+
+func TestInterpreterRegisterFunc(t *testing.T) {
+	i := NewInterpreter()
+	i.RegisterFunc("sum", func(args []Value) (Value, error) {
+		total := IntValue(0)
+		for _, arg := range args {
+			n, ok := arg.(IntValue)
+			if !ok {
+				return nil, fmt.Errorf("not an integer")
+			}
+			total += n
+		}
+		return total, nil
+	})
+	i.RegisterFuncArity("twice", 1, 1, func(args []Value) (Value, error) {
+		return args[0].(IntValue) * 2, nil
+	})
+	i.RegisterFuncArity("len", 0, 0, func(args []Value) (Value, error) {
+		return IntValue(1138), nil
+	})
+	i.RegisterFunc("nothing", func(args []Value) (Value, error) {
+		return nil, nil
+	})
+	require.NoError(t, i.LoadValue("custom", customValue{}))
+
+	type testCase struct {
+		input    string
+		expected any
+	}
+	cases := []testCase{
+		{input: "sum()", expected: 0},
+		{input: "sum(1, 2, 3)", expected: 6},
+		{input: "twice(sum(1, 2))", expected: 6},
+		{input: "len()", expected: 1138},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			val, err := i.Evaluate(expr)
+			require.NoError(t, err)
+			require.EqualValues(t, c.expected, val)
+		})
+	}
+
+	errorCases := []string{
+		"twice()",
+		"twice(1, 2)",
+		`sum(1, "hello")`,
+		"unknown(1)",
+		"nothing()",
+		"nothing() + 1",
+		"custom + 1",
+	}
+	for _, c := range errorCases {
+		t.Run(c, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			_, err = i.Evaluate(expr)
+			require.Error(t, err)
+			snaps.MatchSnapshot(t, err)
+		})
+	}
+}
+
+// customValue is a Value implemented outside of the types of the interpreter.
+type customValue struct {
+	NullValue
+}
+
+// tagsValue is a Value implemented outside of the types of the interpreter,
+// whose values cannot be compared with ==.
+type tagsValue []string
+
+func (tagsValue) GetInteger() (int64, bool)        { return 0, false }
+func (tagsValue) GetDecimal() (float64, bool)      { return 0, false }
+func (tagsValue) GetString() (string, bool)        { return "", false }
+func (tagsValue) GetBool() (bool, bool)            { return false, false }
+func (tagsValue) GetNull() (interface{}, bool)     { return nil, false }
+func (tagsValue) GetList() ([]Value, bool)         { return nil, false }
+func (tagsValue) GetMap() (map[string]Value, bool) { return nil, false }
+
+func TestInterpreterForeignValueMembership(t *testing.T) {
+	state := map[string]any{"tags": tagsValue{"vip"}, "custom": customValue{}}
+	cases := map[string]bool{
+		"tags in [tags]":           false,
+		"tags in [1, custom]":      false,
+		"tags not in [tags]":       true,
+		"custom in [custom]":       true,
+		"[tags] in [[tags]]":       false,
+		"custom in [tags, custom]": true,
+	}
+	for input, expected := range cases {
+		t.Run(input, func(t *testing.T) {
+			i, expr, code := compileTest(t, input, state)
+			val, err := i.Evaluate(expr)
+			require.NoError(t, err)
+			require.Equal(t, BoolValue(expected), val)
+			val, err = code.run(context.Background(), i, nil)
+			require.NoError(t, err)
+			require.Equal(t, BoolValue(expected), val)
+		})
+	}
+}
+
+func TestInterpreterLoadList(t *testing.T) {
+	i := NewInterpreter()
+	err := i.LoadList("xs", []any{1, "two", []any{3.0}})
+	require.NoError(t, err)
+	err = i.LoadList("bad", []any{func() {}})
+	require.Error(t, err)
+
+	tokens, err := Scan(strings.NewReader("xs[2][0]"))
+	require.NoError(t, err)
+	expr, err := Parse(tokens)
+	require.NoError(t, err)
+	val, err := i.Evaluate(expr)
+	require.NoError(t, err)
+	require.EqualValues(t, 3.0, val)
+}
+
 var benchmarkValue Value
 
 func BenchmarkInterpreter(b *testing.B) {
@@ -0,0 +1,212 @@
+package pock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDepthLimit(t *testing.T) {
+	n := DefaultMaxDepth * 2
+	cases := map[string]string{
+		"groups": strings.Repeat("(", n) + "1" + strings.Repeat(")", n),
+		"unary":  strings.Repeat("-", n) + "1",
+		"power":  strings.Repeat("2 ** ", n) + "2",
+		"chain":  strings.Repeat("1 + ", n) + "1",
+		"list":   strings.Repeat("[", n) + strings.Repeat("]", n),
+	}
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(input))
+			require.NoError(t, err)
+			_, err = Parse(tokens)
+			var limitErr *LimitError
+			require.ErrorAs(t, err, &limitErr)
+			require.Equal(t, DepthLimit, limitErr.Kind)
+			require.Equal(t, DefaultMaxDepth, limitErr.Limit)
+		})
+	}
+}
+
+func TestCompileLimits(t *testing.T) {
+	type testCase struct {
+		input string
+		opts  []Option
+		kind  LimitKind
+	}
+	cases := []testCase{
+		{input: "1 + 2", opts: []Option{WithMaxSourceLength(5)}},
+		{input: "1 + 23", opts: []Option{WithMaxSourceLength(5)}, kind: SourceLengthLimit},
+		{input: "((1))", opts: []Option{WithMaxDepth(3)}},
+		{input: "(((1)))", opts: []Option{WithMaxDepth(3)}, kind: DepthLimit},
+		{input: "1 + 2 + 3", opts: []Option{WithMaxDepth(3)}},
+		{input: "1 + 2 + 3 + 4", opts: []Option{WithMaxDepth(3)}, kind: DepthLimit},
+		{input: "f(g(1))", opts: []Option{WithMaxDepth(3)}},
+		{input: "f(g(h(1)))", opts: []Option{WithMaxDepth(3)}, kind: DepthLimit},
+		{input: strings.Repeat("1 + ", DefaultMaxDepth) + "1", kind: DepthLimit},
+		{input: strings.Repeat("1 + ", DefaultMaxDepth) + "1", opts: []Option{WithMaxDepth(0)}},
+	}
+	for _, c := range cases {
+		t.Run(c.input[:min(len(c.input), 20)], func(t *testing.T) {
+			_, err := Compile(c.input, c.opts...)
+			if c.kind == InvalidLimit {
+				require.NoError(t, err)
+				return
+			}
+			var limitErr *LimitError
+			require.ErrorAs(t, err, &limitErr)
+			require.Equal(t, c.kind, limitErr.Kind)
+		})
+	}
+}
+
+func TestEvaluateLimits(t *testing.T) {
+	type testCase struct {
+		input string
+		opts  []Option
+		kind  LimitKind
+		span  Span
+	}
+	cases := []testCase{
+		{input: "x + x + x", opts: []Option{WithMaxSteps(5)}},
+		{input: "x + x + x", opts: []Option{WithMaxSteps(4)}, kind: StepLimit},
+		{input: `s + s`, opts: []Option{WithMaxStringLength(6)}},
+		{
+			input: `s + s + s`,
+			opts:  []Option{WithMaxStringLength(6)},
+			kind:  StringLengthLimit,
+			span:  Span{Start: Position{0, 1, 1}, End: Position{9, 1, 10}},
+		},
+		{
+			input: `upper(s + s) + "!"`,
+			opts:  []Option{WithMaxStringLength(6)},
+			kind:  StringLengthLimit,
+			span:  Span{Start: Position{0, 1, 1}, End: Position{18, 1, 19}},
+		},
+		{input: "s + s + s ?? 1", opts: []Option{WithMaxStringLength(6)}, kind: StringLengthLimit},
+		{input: `"ab" + "c"`, opts: []Option{WithMaxStringLength(3)}},
+		{
+			input: `"ab" + "cd"`,
+			opts:  []Option{WithMaxStringLength(3)},
+			kind:  StringLengthLimit,
+			span:  Span{Start: Position{0, 1, 1}, End: Position{11, 1, 12}},
+		},
+		{
+			input: `upper("ab" + "cd")`,
+			opts:  []Option{WithMaxStringLength(3)},
+			kind:  StringLengthLimit,
+			span:  Span{Start: Position{6, 1, 7}, End: Position{17, 1, 18}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			state := map[string]any{"x": 1, "s": "abc"}
+
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			i, err := NewInterpreterWithState(state, c.opts...)
+			require.NoError(t, err)
+			_, evalErr := i.Evaluate(expr)
+
+			p, err := Compile(c.input, c.opts...)
+			require.NoError(t, err)
+			env, err := NewMapEnv(state)
+			require.NoError(t, err)
+			_, runErr := p.Run(env)
+
+			for _, err := range []error{evalErr, runErr} {
+				if c.kind == InvalidLimit {
+					require.NoError(t, err)
+					continue
+				}
+				var limitErr *LimitError
+				require.ErrorAs(t, err, &limitErr)
+				require.Equal(t, c.kind, limitErr.Kind)
+				if c.span != (Span{}) {
+					require.Equal(t, c.span, limitErr.Span)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateDepthLimit(t *testing.T) {
+	var expr Expr = LiteralExpr{Token: Token{Type: Integer, IntegerValue: 1}}
+	for range 10 {
+		expr = UnaryExpr{Op: Minus, Expr: expr}
+	}
+
+	val, err := NewInterpreter(WithMaxDepth(11)).Evaluate(expr)
+	require.NoError(t, err)
+	require.Equal(t, IntValue(1), val)
+
+	_, err = NewInterpreter(WithMaxDepth(10)).Evaluate(expr)
+	var limitErr *LimitError
+	require.ErrorAs(t, err, &limitErr)
+	require.Equal(t, DepthLimit, limitErr.Kind)
+}
+
+func TestEvaluateContext(t *testing.T) {
+	input := "x == x" + strings.Repeat(" && x == x", 100)
+	tokens, err := Scan(strings.NewReader(input))
+	require.NoError(t, err)
+	expr, err := Parse(tokens)
+	require.NoError(t, err)
+	p, err := Compile(input)
+	require.NoError(t, err)
+	i := NewInterpreter()
+	i.LoadInt("x", 1)
+	env := MapEnv{"x": IntValue(1)}
+
+	val, err := i.EvaluateContext(context.Background(), expr)
+	require.NoError(t, err)
+	require.Equal(t, BoolValue(true), val)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = i.EvaluateContext(ctx, expr)
+	requireInterrupted(t, err, context.Canceled)
+	_, err = p.RunContext(ctx, env)
+	requireInterrupted(t, err, context.Canceled)
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = i.EvaluateContext(ctx, expr)
+	requireInterrupted(t, err, context.DeadlineExceeded)
+	_, err = p.RunContext(ctx, env)
+	requireInterrupted(t, err, context.DeadlineExceeded)
+}
+
+// TestEvaluateContextCancel checks that an evaluation stops shortly after its
+// context is canceled.
+func TestEvaluateContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	i := NewInterpreter()
+	i.RegisterFunc("cancel", func(args []Value) (Value, error) {
+		cancel()
+		return BoolValue(true), nil
+	})
+	i.LoadInt("x", 1)
+
+	tokens, err := Scan(strings.NewReader("cancel()" + strings.Repeat(" && x == x", 100)))
+	require.NoError(t, err)
+	expr, err := Parse(tokens)
+	require.NoError(t, err)
+	_, err = i.EvaluateContext(ctx, expr)
+	requireInterrupted(t, err, context.Canceled)
+}
+
+func requireInterrupted(t *testing.T, err error, cause error) {
+	t.Helper()
+	var limitErr *LimitError
+	require.ErrorAs(t, err, &limitErr)
+	require.Equal(t, Interrupted, limitErr.Kind)
+	require.True(t, errors.Is(err, cause))
+}
@@ -0,0 +1,280 @@
+package pock
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Optimize returns an expression that evaluates to the same value, or fails
+// with the same error, as expr, but does less work:
+//
+//   - constant subexpressions, such as `60 * 60 * 24`, are folded into
+//     literals, using the semantics of the interpreter;
+//   - boolean identities, such as `true && x` or `!!x`, are simplified when x
+//     is known to be boolean;
+//   - groups are removed, as the structure of the tree already holds the
+//     precedence of operators.
+//
+// Constant subexpressions are folded with an interpreter created with opts,
+// which should be the options of the interpreter that evaluates the result, so
+// that its limits apply to them. Constant subexpressions that fail, such as
+// `1 / 0` or a concatenation longer than WithMaxStringLength, are left in place
+// to fail when evaluated. Calls are never folded, as functions may be replaced
+// with RegisterFunc.
+func Optimize(expr Expr, opts ...Option) Expr {
+	return optimize(expr, NewInterpreter(opts...))
+}
+
+// optimize is like Optimize, but folds constants with interpreter, so that its
+// options and limits apply to them, and the folds that would fail with it are
+// left to fail when evaluated.
+func optimize(expr Expr, interpreter *Interpreter) Expr {
+	o := optimizer{interpreter: interpreter}
+	return o.optimize(expr)
+}
+
+type optimizer struct {
+	interpreter *Interpreter
+}
+
+func (o optimizer) optimize(expr Expr) Expr {
+	switch expr := expr.(type) {
+	case ConditionalExpr:
+		return o.optimizeConditional(expr)
+	case BinaryExpr:
+		return o.optimizeBinary(expr)
+	case UnaryExpr:
+		return o.optimizeUnary(expr)
+	case GroupExpr:
+		return o.optimize(expr.Expr)
+	case GetExpr:
+		return expr
+	case IndexExpr:
+		expr = o.optimizeLink(expr)
+		return o.fold(expr, expr.Target, expr.Index)
+	case CallExpr:
+		args := make([]Expr, len(expr.Args))
+		for i, arg := range expr.Args {
+			args[i] = o.optimize(arg)
+		}
+		expr.Args = args
+		return expr
+	case ListExpr:
+		elements := make([]Expr, len(expr.Elements))
+		for i, element := range expr.Elements {
+			elements[i] = o.optimize(element)
+		}
+		expr.Elements = elements
+		return expr
+	case MapExpr:
+		entries := make([]MapEntry, len(expr.Entries))
+		for i, entry := range expr.Entries {
+			entries[i] = MapEntry{Key: entry.Key, Value: o.optimize(entry.Value)}
+		}
+		expr.Entries = entries
+		return expr
+	case LiteralExpr:
+		return expr
+	}
+	panic("invalid expression")
+}
+
+// optimizeLink optimizes the operands of expr, a link of a chain of postfix
+// operators. A `?.` link is not folded into its chain, as the null it yields
+// skips the rest of the chain, but a literal null would not.
+func (o optimizer) optimizeLink(expr IndexExpr) IndexExpr {
+	switch target := expr.Target.(type) {
+	case IndexExpr:
+		link := o.optimizeLink(target)
+		if link.Optional {
+			expr.Target = link
+		} else {
+			expr.Target = o.fold(link, link.Target, link.Index)
+		}
+	case GroupExpr:
+		// A group ends the chain inside it, so it is kept around an index.
+		inner := o.optimize(target.Expr)
+		if _, ok := inner.(IndexExpr); ok {
+			target.Expr = inner
+			expr.Target = target
+		} else {
+			expr.Target = inner
+		}
+	default:
+		expr.Target = o.optimize(target)
+	}
+	expr.Index = o.optimize(expr.Index)
+	return expr
+}
+
+func (o optimizer) optimizeConditional(expr ConditionalExpr) Expr {
+	expr.Cond = o.optimize(expr.Cond)
+	expr.Then = o.optimize(expr.Then)
+	expr.Else = o.optimize(expr.Else)
+
+	if cond, ok := boolLiteral(expr.Cond); ok {
+		if cond {
+			return expr.Then
+		}
+		return expr.Else
+	}
+	if isBoolean(expr.Cond) {
+		then, thenOk := boolLiteral(expr.Then)
+		els, elseOk := boolLiteral(expr.Else)
+		switch {
+		case thenOk && elseOk && then && !els:
+			return expr.Cond
+		case thenOk && elseOk && !then && els:
+			return UnaryExpr{Op: Not, Expr: expr.Cond, Span: expr.Span}
+		}
+	}
+	return expr
+}
+
+func (o optimizer) optimizeBinary(expr BinaryExpr) Expr {
+	expr.Left = o.optimize(expr.Left)
+	expr.Right = o.optimize(expr.Right)
+
+	switch expr.Op {
+	case Or, And:
+		// The left operand is returned if it determines the result, and the
+		// right operand otherwise, provided it is boolean.
+		if left, ok := boolLiteral(expr.Left); ok {
+			if left == (expr.Op == Or) {
+				return expr.Left
+			}
+			if isBoolean(expr.Right) {
+				return expr.Right
+			}
+		}
+		if right, ok := boolLiteral(expr.Right); ok && right == (expr.Op == And) && isBoolean(expr.Left) {
+			return expr.Left
+		}
+	case QuestionQuestion:
+		// Literals are never missing.
+		if left, ok := expr.Left.(LiteralExpr); ok {
+			if left.Token.Type == Null {
+				return expr.Right
+			}
+			return expr.Left
+		}
+	}
+	return o.fold(expr, expr.Left, expr.Right)
+}
+
+func (o optimizer) optimizeUnary(expr UnaryExpr) Expr {
+	expr.Expr = o.optimize(expr.Expr)
+	if inner, ok := expr.Expr.(UnaryExpr); ok && expr.Op == Not && inner.Op == Not && isBoolean(inner.Expr) {
+		return inner.Expr
+	}
+	return o.fold(expr, expr.Expr)
+}
+
+// fold evaluates expr if its operands are constant, and returns a literal of
+// the result. expr is returned as is if an operand is not constant, if the
+// evaluation fails, or if the result is a list or a map.
+func (o optimizer) fold(expr Expr, operands ...Expr) Expr {
+	for _, operand := range operands {
+		if !isConstant(operand) {
+			return expr
+		}
+	}
+	val, err := o.interpreter.Evaluate(expr)
+	if err != nil {
+		return expr
+	}
+	if lit, ok := literalOf(val, SpanOf(expr)); ok {
+		return lit
+	}
+	return expr
+}
+
+// isConstant reports whether expr is a literal, or a list or map of constants.
+func isConstant(expr Expr) bool {
+	switch expr := expr.(type) {
+	case LiteralExpr:
+		return true
+	case ListExpr:
+		for _, element := range expr.Elements {
+			if !isConstant(element) {
+				return false
+			}
+		}
+		return true
+	case MapExpr:
+		for _, entry := range expr.Entries {
+			if !isConstant(entry.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isBoolean reports whether expr evaluates to a boolean whenever it does not
+// fail.
+func isBoolean(expr Expr) bool {
+	switch expr := expr.(type) {
+	case BinaryExpr:
+		switch expr.Op {
+		case Lt, Lte, Gt, Gte, Eq, Neq, In, And, Or:
+			return true
+		}
+	case UnaryExpr:
+		return expr.Op == Not
+	case ConditionalExpr:
+		return isBoolean(expr.Then) && isBoolean(expr.Else)
+	case LiteralExpr:
+		return expr.Token.Type == True || expr.Token.Type == False
+	}
+	return false
+}
+
+func boolLiteral(expr Expr) (bool, bool) {
+	lit, ok := expr.(LiteralExpr)
+	if !ok {
+		return false, false
+	}
+	switch lit.Token.Type {
+	case True:
+		return true, true
+	case False:
+		return false, true
+	}
+	return false, false
+}
+
+// literalOf returns a literal of val located at span, if val is not a list or
+// a map.
+func literalOf(val Value, span Span) (LiteralExpr, bool) {
+	tok := Token{Span: span}
+	switch val := val.(type) {
+	case BoolValue:
+		tok.Type, tok.Lexeme = False, "false"
+		if val {
+			tok.Type, tok.Lexeme = True, "true"
+		}
+	case NullValue:
+		tok.Type = Null
+		tok.Lexeme = "null"
+	case IntValue:
+		tok.Type = Integer
+		tok.Lexeme = strconv.FormatInt(int64(val), 10)
+		tok.IntegerValue = int64(val)
+	case DecimalValue:
+		tok.Type = Decimal
+		tok.Lexeme = strconv.FormatFloat(float64(val), 'g', -1, 64)
+		if !strings.ContainsAny(tok.Lexeme, ".eInN") {
+			tok.Lexeme += ".0"
+		}
+		tok.DecimalValue = float64(val)
+	case StringValue:
+		tok.Type = String
+		tok.Lexeme = strconv.Quote(string(val))
+		tok.StringValue = string(val)
+	default:
+		return LiteralExpr{}, false
+	}
+	return LiteralExpr{Token: tok}, true
+}
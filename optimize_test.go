@@ -0,0 +1,135 @@
+package pock
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimize(t *testing.T) {
+	cases := []string{
+		"(60 * 60 * 24) * days",
+		"true && x > 1",
+		"true && x",
+		"x > 1 && true",
+		"x > 1 || false",
+		"false && missing",
+		"true || missing",
+		"!!(x > 1)",
+		"!!x",
+		"x > 1 ? true : false",
+		"x > 1 ? false : true",
+		"1 < 2 ? a : b",
+		"null ?? x",
+		`"a" ?? x`,
+		"((x))",
+		`upper("a" + "b")`,
+		`[1, 2 + 3, {"a": 4 * 5}]`,
+		"[1, 2, 3][1]",
+		`2 in [1, 2, 3] && x`,
+		`"ab" + "cd" == "abcd"`,
+		"1.5 * 2",
+		"1 / 0",
+		"x + 1 / 0",
+		"9223372036854775807 + 1",
+		`1 + "a"`,
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			snaps.MatchSnapshot(t, Optimize(expr))
+		})
+	}
+}
+
+// TestOptimizeAgreesWithEvaluate checks that optimized expressions evaluate to
+// the same values and errors as the original expressions.
+func TestOptimizeAgreesWithEvaluate(t *testing.T) {
+	type testCase struct {
+		state map[string]any
+		input string
+	}
+	var cases []testCase
+	for _, c := range interpreterCases {
+		cases = append(cases, testCase{state: c.state, input: c.input})
+	}
+	for _, c := range interpreterErrorCases {
+		cases = append(cases, testCase{state: c.state, input: c.input})
+	}
+	state := map[string]any{"x": 2, "s": "str", "max": math.MaxInt64}
+	for _, input := range []string{
+		"true && s",
+		"false || s",
+		"s && true",
+		"!!s",
+		"s ? true : false",
+		"(s > 1) ? false : true",
+		"(1 + 2) * 3 + s",
+		"(max + 1 - 1) ?? 0",
+		"[1, 2][5] ?? x",
+		"([1, 2])[0] ?? x",
+		"(missing)[0] ?? (x ?? 1)",
+		"1 / 0 + missing",
+		"0.0 / 0.0 == 0.0 / 0.0",
+		`{"a": 1}.a + {"a": 1}["b"]`,
+		`null?.a ?? "default"`,
+		`{"a": null}?.a.b`,
+		`({"a": null}?.a).b ?? 1`,
+		"[[1, 2]][0][1]",
+		"-(-9223372036854775807 - 1)",
+	} {
+		cases = append(cases, testCase{state: state, input: input})
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			i, err := NewInterpreterWithState(c.state)
+			require.NoError(t, err)
+
+			expectedVal, expectedErr := i.Evaluate(expr)
+			val, err := i.Evaluate(Optimize(expr))
+			require.Equal(t, expectedErr, err)
+			if expectedVal, ok := expectedVal.(DecimalValue); ok && math.IsNaN(float64(expectedVal)) {
+				require.True(t, math.IsNaN(float64(val.(DecimalValue))))
+				return
+			}
+			require.Equal(t, expectedVal, val)
+		})
+	}
+}
+
+func TestOptimizeLimits(t *testing.T) {
+	for _, c := range []struct {
+		input string
+		opts  []Option
+	}{
+		{input: `"aaaa" + "bbbb"`, opts: []Option{WithMaxStringLength(5)}},
+		{input: `9223372036854775807 + 1`, opts: []Option{WithOverflowPromotion()}},
+	} {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			i := NewInterpreter(c.opts...)
+
+			expectedVal, expectedErr := i.Evaluate(expr)
+			val, err := i.Evaluate(Optimize(expr, c.opts...))
+			require.Equal(t, expectedErr, err)
+			require.Equal(t, expectedVal, val)
+		})
+	}
+}
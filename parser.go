@@ -6,28 +6,75 @@ import (
 )
 
 // Syntactical grammar:
-// Expr    -> Or ;
-// Or      -> And ("||" And)* ;
-// And     -> Comp ("&&" Comp)* ;
-// Comp    -> Term (("<" | ">" | ">=" | "<=" | "==" | "!=") Term) ;
-// Term    -> Factor (("+" | "-") Factor)* ;
-// Factor  -> Unary (("*" | "/") Unary)* ;
-// Unary   -> ("!" | "-") Primary ;
-// Primary -> "true" | "false" | "null" | INTEGER | DECIMAL | STRING | "(" Expression ")" | IDENTIFIER ("." IDENTIFIER)* ;
+// Expr     -> Cond ;
+// Cond     -> Coalesce ("?" Expr ":" Cond)? ;
+// Coalesce -> Or ("??" Or)* ;
+// Or       -> And ("||" And)* ;
+// And      -> Comp ("&&" Comp)* ;
+// Comp     -> Term (("<" | ">" | ">=" | "<=" | "==" | "!=" | "in" | "not" "in") Term)? ;
+// Term     -> Factor (("+" | "-") Factor)* ;
+// Factor   -> Unary (("*" | "/" | "%") Unary)* ;
+// Unary    -> ("!" | "-") Unary | Power ;
+// Power    -> Postfix ("**" Unary)? ;
+// Postfix  -> Primary ("[" Expr "]" | "." IDENTIFIER | "?." IDENTIFIER | "?." "[" Expr "]")* ;
+// Primary  -> "true" | "false" | "null" | INTEGER | DECIMAL | STRING | "(" Expression ")" | List | Map | Call | Get ;
+// List     -> "[" (Expr ("," Expr)*)? "]" ;
+// Map      -> "{" (STRING ":" Expr ("," STRING ":" Expr)*)? "}" ;
+// Call     -> IDENTIFIER "(" (Expr ("," Expr)*)? ")" ;
+// Get      -> IDENTIFIER ("." IDENTIFIER)* ;
+//
+// `||` and `&&` short-circuit: the right operand is only evaluated if the left
+// operand is `false` for `||`, or `true` for `&&`. Both operands must be
+// boolean when evaluated.
+//
+// `**` binds tighter than unary operators on its left, so that `-2 ** 2` is
+// `-(2 ** 2)`. In particular, `-2 ** 63` overflows, as `2 ** 63` does not fit
+// in an integer, while `(-2) ** 63` is the minimum integer.
+//
+// `not` is only a keyword when followed by `in`, and `a not in b` is parsed as
+// `!(a in b)`.
+//
+// `?.` yields `null` instead of failing when its left operand is not a map or a
+// list, or does not hold the key or index. Once a `?.` yields `null`, the rest
+// of its chain of accesses is skipped, so that `a?.b.c[0]` is `null` when `a.b`
+// is. `a ?? b` yields `b` if `a` is `null`, if `a` is a variable, key or index
+// that does not exist, or if a value along the path of `a` cannot be indexed;
+// `b` is only evaluated in that case.
+//
+// `?:` only evaluates the branch selected by its condition, which must be
+// boolean.
 
+// DefaultMaxDepth is the maximum depth of the expressions returned by Parse,
+// and the default maximum depth of the expressions compiled and evaluated by
+// an Interpreter. It bounds the recursion of the parser and the interpreter.
+const DefaultMaxDepth = 10000
+
+// Parse parses tokens into an expression, failing with a *LimitError if the
+// expression is nested deeper than DefaultMaxDepth.
 func Parse(tokens []Token) (Expr, error) {
+	return parse(tokens, DefaultMaxDepth)
+}
+
+// parse parses tokens into an expression nested at most maxDepth deep, or at
+// any depth if maxDepth is 0.
+func parse(tokens []Token, maxDepth int) (Expr, error) {
 	var err error
-	p := parser{tokens: tokens}
+	p := parser{tokens: tokens, maxDepth: maxDepth}
 	expr, err := p.parseExpr()
 	if err != nil {
 		return nil, err
 	}
 	if !p.eof() {
-		return nil,
-			fmt.Errorf(
-				"at `%s`: expected end of expression",
-				p.peek().Lexeme,
-			)
+		return nil, p.errorf("at `%s`: expected end of expression", p.peek().Lexeme)
+	}
+	// Chains of binary operators are parsed by loops, so their depth is not
+	// bounded by the recursion of the parser. Every expression consumes at
+	// least one token, so only sources with more tokens than maxDepth need to
+	// be checked.
+	if len(tokens) > maxDepth {
+		if deep, ok := exceedsDepth(expr, maxDepth); ok {
+			return nil, depthError(SpanOf(deep), maxDepth)
+		}
 	}
 	return expr, nil
 }
@@ -35,6 +82,12 @@ func Parse(tokens []Token) (Expr, error) {
 type parser struct {
 	current int
 	tokens  []Token
+
+	// depth is the number of nested calls to parseUnary, through which every
+	// recursion of the parser goes. It never exceeds the depth of the
+	// expression being parsed.
+	depth    int
+	maxDepth int
 }
 
 func (p parser) eof() bool {
@@ -48,6 +101,30 @@ func (p parser) peek() Token {
 	return p.tokens[p.current]
 }
 
+// span returns the span of the current token, or an empty span after the last
+// token if all tokens have been consumed.
+func (p parser) span() Span {
+	if !p.eof() {
+		return p.peek().Span
+	}
+	pos := Position{Line: 1, Column: 1}
+	if len(p.tokens) > 0 {
+		pos = p.tokens[len(p.tokens)-1].Span.End
+	}
+	return Span{Start: pos, End: pos}
+}
+
+func (p parser) errorf(format string, args ...any) *ParseError {
+	return &ParseError{Span: p.span(), Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p parser) peekNext() Token {
+	if p.current+1 >= len(p.tokens) {
+		return Token{}
+	}
+	return p.tokens[p.current+1]
+}
+
 func (p *parser) advance() (Token, error) {
 	p.current++
 	if p.eof() {
@@ -57,10 +134,62 @@ func (p *parser) advance() (Token, error) {
 }
 
 func (p *parser) parseExpr() (Expr, error) {
+	expr, err := p.parseCond()
+	if err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func (p *parser) parseCond() (Expr, error) {
+	expr, err := p.parseCoalesce()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().Type != Question {
+		return expr, nil
+	}
+	_, _ = p.advance()
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != Colon {
+		if p.eof() {
+			return nil, p.errorf("unexpected end of expression")
+		}
+		return nil, p.errorf("at `%s`: expected `:` in conditional expression", p.peek().Lexeme)
+	}
+	_, _ = p.advance()
+	els, err := p.parseCond()
+	if err != nil {
+		return nil, err
+	}
+
+	return ConditionalExpr{
+		Cond: expr,
+		Then: then,
+		Else: els,
+		Span: Span{Start: SpanOf(expr).Start, End: SpanOf(els).End},
+	}, nil
+}
+
+func (p *parser) parseCoalesce() (Expr, error) {
 	expr, err := p.parseOr()
 	if err != nil {
 		return nil, err
 	}
+
+	for p.peek().Type == QuestionQuestion {
+		_, _ = p.advance()
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		expr = newBinaryExpr(QuestionQuestion, expr, right)
+	}
+
 	return expr, nil
 }
 
@@ -76,7 +205,7 @@ func (p *parser) parseOr() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = BinaryExpr{Op: Or, Left: expr, Right: right}
+		expr = newBinaryExpr(Or, expr, right)
 	}
 
 	return expr, nil
@@ -94,7 +223,7 @@ func (p *parser) parseAnd() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = BinaryExpr{Op: And, Left: expr, Right: right}
+		expr = newBinaryExpr(And, expr, right)
 	}
 
 	return expr, nil
@@ -112,13 +241,25 @@ func (p *parser) parseComp() (Expr, error) {
 		peekType == Gt ||
 		peekType == Gte ||
 		peekType == Eq ||
-		peekType == Neq {
+		peekType == Neq ||
+		peekType == In {
+		_, _ = p.advance()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return newBinaryExpr(peekType, expr, right), nil
+	}
+
+	if tok := p.peek(); tok.Type == Identifier && tok.Lexeme == "not" && p.peekNext().Type == In {
+		_, _ = p.advance()
 		_, _ = p.advance()
 		right, err := p.parseTerm()
 		if err != nil {
 			return nil, err
 		}
-		return BinaryExpr{Op: peekType, Left: expr, Right: right}, nil
+		in := newBinaryExpr(In, expr, right)
+		return UnaryExpr{Op: Not, Expr: in, Span: in.Span}, nil
 	}
 
 	return expr, nil
@@ -130,14 +271,13 @@ func (p *parser) parseTerm() (Expr, error) {
 		return nil, err
 	}
 
-	peekType := p.peek().Type
-	if peekType == Plus || peekType == Minus {
+	for peekType := p.peek().Type; peekType == Plus || peekType == Minus; peekType = p.peek().Type {
 		_, _ = p.advance()
 		right, err := p.parseFactor()
 		if err != nil {
 			return nil, err
 		}
-		return BinaryExpr{Op: peekType, Left: expr, Right: right}, nil
+		expr = newBinaryExpr(peekType, expr, right)
 	}
 
 	return expr, nil
@@ -149,36 +289,130 @@ func (p *parser) parseFactor() (Expr, error) {
 		return nil, err
 	}
 
-	peekType := p.peek().Type
-	if peekType == Star || peekType == Slash {
+	for peekType := p.peek().Type; peekType == Star || peekType == Slash || peekType == Percent; peekType = p.peek().Type {
 		_, _ = p.advance()
 		right, err := p.parseUnary()
 		if err != nil {
 			return nil, err
 		}
-		return BinaryExpr{Op: peekType, Left: expr, Right: right}, nil
+		expr = newBinaryExpr(peekType, expr, right)
 	}
 
 	return expr, nil
 }
 
 func (p *parser) parseUnary() (Expr, error) {
-	peekType := p.peek().Type
-	if peekType == Not || peekType == Minus {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.maxDepth > 0 && p.depth > p.maxDepth {
+		return nil, depthError(p.span(), p.maxDepth)
+	}
+
+	tok := p.peek()
+	if tok.Type == Not || tok.Type == Minus {
+		_, _ = p.advance()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return UnaryExpr{
+			Op:   tok.Type,
+			Expr: expr,
+			Span: Span{Start: tok.Span.Start, End: SpanOf(expr).End},
+		}, nil
+	}
+
+	return p.parsePower()
+}
+
+func (p *parser) parsePower() (Expr, error) {
+	expr, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().Type == StarStar {
 		_, _ = p.advance()
-		expr, err := p.parsePrimary()
+		right, err := p.parseUnary()
 		if err != nil {
 			return nil, err
 		}
-		return UnaryExpr{Op: peekType, Expr: expr}, nil
+		return newBinaryExpr(StarStar, expr, right), nil
 	}
 
-	return p.parsePrimary()
+	return expr, nil
+}
+
+func (p *parser) parsePostfix() (Expr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch p.peek().Type {
+		case LeftBracket:
+			expr, err = p.parseIndex(expr, false)
+		case Dot:
+			_, _ = p.advance()
+			expr, err = p.parseMember(expr, false, "`.`")
+		case QuestionDot:
+			_, _ = p.advance()
+			if p.peek().Type == LeftBracket {
+				expr, err = p.parseIndex(expr, true)
+			} else {
+				expr, err = p.parseMember(expr, true, "`?.`")
+			}
+		default:
+			return expr, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseIndex(target Expr, optional bool) (Expr, error) {
+	_, _ = p.advance()
+	index, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != RightBracket {
+		return nil, p.errorf("missing closing bracket")
+	}
+	end := p.peek().Span.End
+	_, _ = p.advance()
+	return IndexExpr{
+		Target:   target,
+		Index:    index,
+		Optional: optional,
+		Span:     Span{Start: SpanOf(target).Start, End: end},
+	}, nil
+}
+
+func (p *parser) parseMember(target Expr, optional bool, after string) (Expr, error) {
+	tok := p.peek()
+	if tok.Type != Identifier {
+		return nil, p.errorf("at `%s`: expected identifier after %s", tok.Lexeme, after)
+	}
+	_, _ = p.advance()
+	return IndexExpr{
+		Target: target,
+		Index: LiteralExpr{Token: Token{
+			Type:        String,
+			Lexeme:      tok.Lexeme,
+			Span:        tok.Span,
+			StringValue: tok.Lexeme,
+		}},
+		Optional: optional,
+		Span:     Span{Start: SpanOf(target).Start, End: tok.Span.End},
+	}, nil
 }
 
 func (p *parser) parsePrimary() (Expr, error) {
 	if p.eof() {
-		return nil, fmt.Errorf("unexpected end of expression")
+		return nil, p.errorf("unexpected end of expression")
 	}
 
 	tok := p.peek()
@@ -188,35 +422,201 @@ func (p *parser) parsePrimary() (Expr, error) {
 		return LiteralExpr{Token: tok}, nil
 	case LeftParen:
 		return p.parseGroup()
+	case LeftBracket:
+		return p.parseList()
+	case LeftBrace:
+		return p.parseMap()
 	case Identifier:
+		if p.peekNext().Type == LeftParen {
+			return p.parseCall()
+		}
 		return p.parseGet()
 	}
 
-	return nil, fmt.Errorf("at `%s`: unexpected token", tok.Lexeme)
+	return nil, p.errorf("at `%s`: unexpected token", tok.Lexeme)
 }
 
 func (p *parser) parseGroup() (Expr, error) {
+	start := p.peek().Span.Start
 	_, _ = p.advance()
 	expr, err := p.parseExpr()
 	if err != nil {
 		return nil, err
 	}
 	if p.peek().Type != RightParen {
-		return nil, fmt.Errorf("missing closing parenthesis")
+		return nil, p.errorf("missing closing parenthesis")
 	}
+	end := p.peek().Span.End
 	_, _ = p.advance()
-	return GroupExpr{Expr: expr}, nil
+	return GroupExpr{Expr: expr, Span: Span{Start: start, End: end}}, nil
+}
+
+func (p *parser) parseList() (Expr, error) {
+	start := p.peek().Span.Start
+	_, _ = p.advance()
+	elements, end, err := p.parseExprList(RightBracket, "list")
+	if err != nil {
+		return nil, err
+	}
+	return ListExpr{Elements: elements, Span: Span{Start: start, End: end}}, nil
+}
+
+func (p *parser) parseMap() (Expr, error) {
+	start := p.peek().Span.Start
+	_, _ = p.advance()
+
+	entries := []MapEntry{}
+	keys := map[string]bool{}
+	if p.peek().Type != RightBrace {
+		for {
+			key := p.peek()
+			if key.Type != String {
+				if p.eof() {
+					return nil, p.errorf("missing closing brace")
+				}
+				return nil, p.errorf("at `%s`: expected string key in map", key.Lexeme)
+			}
+			if keys[key.StringValue] {
+				return nil, p.errorf("duplicate key %s in map", key.Lexeme)
+			}
+			keys[key.StringValue] = true
+			_, _ = p.advance()
+			if p.peek().Type != Colon {
+				if p.eof() {
+					return nil, p.errorf("missing closing brace")
+				}
+				return nil, p.errorf("at `%s`: expected `:` after map key", p.peek().Lexeme)
+			}
+			_, _ = p.advance()
+			val, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, MapEntry{Key: key.StringValue, Value: val})
+			if p.peek().Type != Comma {
+				break
+			}
+			_, _ = p.advance()
+		}
+	}
+	if p.peek().Type != RightBrace {
+		if p.eof() {
+			return nil, p.errorf("missing closing brace")
+		}
+		return nil, p.errorf("at `%s`: expected `,` or `}` in map", p.peek().Lexeme)
+	}
+	end := p.peek().Span.End
+	_, _ = p.advance()
+
+	return MapExpr{Entries: entries, Span: Span{Start: start, End: end}}, nil
+}
+
+func (p *parser) parseCall() (Expr, error) {
+	name := p.peek()
+	_, _ = p.advance()
+	_, _ = p.advance()
+	args, end, err := p.parseExprList(RightParen, "arguments")
+	if err != nil {
+		return nil, err
+	}
+	return CallExpr{
+		Name: name.Lexeme,
+		Args: args,
+		Span: Span{Start: name.Span.Start, End: end},
+	}, nil
+}
+
+// parseExprList parses comma-separated expressions up to and including the
+// closing token, and returns the expressions and the end of the closing token.
+func (p *parser) parseExprList(closing TokenType, what string) ([]Expr, Position, error) {
+	exprs := []Expr{}
+	if p.peek().Type != closing {
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, Position{}, err
+			}
+			exprs = append(exprs, expr)
+			if p.peek().Type != Comma {
+				break
+			}
+			_, _ = p.advance()
+		}
+	}
+	if p.peek().Type != closing {
+		if p.eof() && closing == RightParen {
+			return nil, Position{}, p.errorf("missing closing parenthesis")
+		}
+		if p.eof() {
+			return nil, Position{}, p.errorf("missing closing bracket")
+		}
+		return nil, Position{}, p.errorf(
+			"at `%s`: expected `,` or `%s` in %s",
+			p.peek().Lexeme,
+			operatorLexeme(closing),
+			what,
+		)
+	}
+	end := p.peek().Span.End
+	_, _ = p.advance()
+	return exprs, end, nil
 }
 
 func (p *parser) parseGet() (Expr, error) {
-	names := []string{p.peek().Lexeme}
+	tok := p.peek()
+	names := []string{tok.Lexeme}
+	span := tok.Span
 	for _, _ = p.advance(); p.peek().Type == Dot; _, _ = p.advance() {
 		_, _ = p.advance()
-		tok := p.peek()
+		tok = p.peek()
 		if tok.Type != Identifier {
-			return nil, fmt.Errorf("at `%s`: expected identifier after `.`", tok.Lexeme)
+			return nil, p.errorf("at `%s`: expected identifier after `.`", tok.Lexeme)
 		}
 		names = append(names, tok.Lexeme)
+		span.End = tok.Span.End
+	}
+	return GetExpr{Names: names, Span: span}, nil
+}
+
+func newBinaryExpr(op TokenType, left, right Expr) BinaryExpr {
+	return BinaryExpr{
+		Op:    op,
+		Left:  left,
+		Right: right,
+		Span:  Span{Start: SpanOf(left).Start, End: SpanOf(right).End},
+	}
+}
+
+// exceedsDepth returns a sub-expression of expr nested deeper than maxDepth,
+// counting expr itself as depth 1, if there is one and maxDepth is not 0. expr
+// is walked without recursion, as it may be too deep to recurse into.
+func exceedsDepth(expr Expr, maxDepth int) (Expr, bool) {
+	if maxDepth <= 0 {
+		return nil, false
+	}
+	type node struct {
+		expr  Expr
+		depth int
+	}
+	stack := []node{{expr: expr, depth: 1}}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.depth > maxDepth {
+			return n.expr, true
+		}
+		for _, child := range children(n.expr) {
+			stack = append(stack, node{expr: child, depth: n.depth + 1})
+		}
+	}
+	return nil, false
+}
+
+func depthError(span Span, maxDepth int) *LimitError {
+	return &LimitError{
+		Kind:  DepthLimit,
+		Limit: maxDepth,
+		Span:  span,
+		Msg:   fmt.Sprintf("expression nested deeper than %d levels", maxDepth),
 	}
-	return GetExpr{Names: names}, nil
 }
@@ -19,9 +19,20 @@ func TestParser(t *testing.T) {
 		{
 			input: "1 == 2",
 			expected: BinaryExpr{
-				Op:    Eq,
-				Left:  LiteralExpr{Token: Token{Type: Integer, Lexeme: "1", IntegerValue: 1}},
-				Right: LiteralExpr{Token: Token{Type: Integer, Lexeme: "2", IntegerValue: 2}},
+				Op: Eq,
+				Left: LiteralExpr{Token: Token{
+					Type:         Integer,
+					Lexeme:       "1",
+					Span:         Span{Start: Position{0, 1, 1}, End: Position{1, 1, 2}},
+					IntegerValue: 1,
+				}},
+				Right: LiteralExpr{Token: Token{
+					Type:         Integer,
+					Lexeme:       "2",
+					Span:         Span{Start: Position{5, 1, 6}, End: Position{6, 1, 7}},
+					IntegerValue: 2,
+				}},
+				Span: Span{Start: Position{0, 1, 1}, End: Position{6, 1, 7}},
 			},
 		},
 	}
@@ -45,6 +56,39 @@ func TestParserSnapshots(t *testing.T) {
 		"((3+2) - 14) == -19",
 		`123.45 * "d" < asdrg`,
 		"true && false || null == (42 / 2)",
+		"1 + 2 + 3",
+		"1 - 2 - 3 - 4",
+		"2 * 3 / 4 * 5",
+		"1 + 2 * 3 - 4 / 5 + 6",
+		"price * quantity - discount + tax * price / 100",
+		"!!flag",
+		"- -3",
+		"!-x",
+		"2 ** 3 ** 2",
+		"-2 ** 2",
+		"a * b % c ** -d",
+		"now()",
+		"max(a, b.c + 1)",
+		"round(price * (1 + rate), 2) > 10",
+		"premium ? 0.1 : 0.05",
+		"a || b ? c && d : e",
+		"a ? b ? 1 : 2 : c ? 3 : 4",
+		"[]",
+		"[1, 2.5, \"three\", [true]]",
+		"xs[0] + xs[-1]",
+		"users[0].address.city",
+		"matrix[i][j] ** 2",
+		"max(a, b)[0]",
+		"{}",
+		`{"a": 1, "weird-key": [x, y], "nested": {"b": c}}`,
+		`obj["weird-key"].value`,
+		`country in ["FR", "DE"]`,
+		`country not in ["FR", "DE"] && not`,
+		`"a" + b in c`,
+		"a?.b?.c",
+		"a.b?.[0].c",
+		"a ?? b ?? c",
+		"a || b ?? c ? d : e",
 	}
 	t.Parallel()
 	for _, c := range cases {
@@ -58,6 +102,32 @@ func TestParserSnapshots(t *testing.T) {
 	}
 }
 
+func TestParserSpans(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected Span
+	}
+	cases := []testCase{
+		{input: "hello", expected: Span{Start: Position{0, 1, 1}, End: Position{5, 1, 6}}},
+		{input: " hello.world ", expected: Span{Start: Position{1, 1, 2}, End: Position{12, 1, 13}}},
+		{input: "-3", expected: Span{Start: Position{0, 1, 1}, End: Position{2, 1, 3}}},
+		{input: "( 1 )", expected: Span{Start: Position{0, 1, 1}, End: Position{5, 1, 6}}},
+		{input: "1 +\n  2", expected: Span{Start: Position{0, 1, 1}, End: Position{7, 2, 4}}},
+		{input: `"é" == x`, expected: Span{Start: Position{0, 1, 1}, End: Position{9, 1, 9}}},
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, SpanOf(expr))
+		})
+	}
+}
+
 func TestParserErrors(t *testing.T) {
 	cases := []string{
 		"",
@@ -68,10 +138,48 @@ func TestParserErrors(t *testing.T) {
 		"4 << 54",
 		"(41 + d",
 		`(""+)`,
-		"--3",
 		"3*",
 		"true && || false",
 		"true || && false",
+		"2 **",
+		"2 ** ** 3",
+		"% 2",
+		"max(",
+		"max(1,",
+		"max(1 2)",
+		"max(1,)",
+		"max(,1)",
+		"a ?",
+		"a ? b",
+		"a ? b c",
+		"a ? b :",
+		"a : b",
+		"[",
+		"[1,",
+		"[1 2]",
+		"xs[",
+		"xs[0",
+		"xs[]",
+		"xs[0].",
+		"xs[0].1",
+		"{",
+		`{"a"`,
+		`{"a":`,
+		`{"a": 1`,
+		`{"a" 1}`,
+		`{a: 1}`,
+		`{"a": 1 "b": 2}`,
+		`{"a": 1, "a": 2}`,
+		`{"a": 1,}`,
+		"a in",
+		"a not",
+		"a not b",
+		"in b",
+		"a in b in c",
+		"a?.",
+		"a?.1",
+		"a??",
+		"?? b",
 	}
 	t.Parallel()
 	for _, c := range cases {
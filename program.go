@@ -0,0 +1,76 @@
+package pock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Program is a compiled expression. A Program is immutable, and can be cached
+// and run concurrently against different states.
+type Program struct {
+	src  string
+	expr Expr
+	code *bytecode
+
+	// interpreter holds the functions and options shared by every run. It is
+	// never modified after Compile returns.
+	interpreter *Interpreter
+}
+
+// Compile scans, parses and optimizes src into a Program. The options apply to
+// every run of the program.
+func Compile(src string, opts ...Option) (*Program, error) {
+	interpreter := NewInterpreter(opts...)
+	limits := interpreter.limits
+	if limits.maxSourceLength > 0 && len(src) > limits.maxSourceLength {
+		start := Position{Line: 1, Column: 1}
+		return nil, &LimitError{
+			Kind:  SourceLengthLimit,
+			Limit: limits.maxSourceLength,
+			Span:  Span{Start: start, End: start},
+			Msg: fmt.Sprintf(
+				"source of %d bytes exceeds the limit of %d bytes",
+				len(src),
+				limits.maxSourceLength,
+			),
+		}
+	}
+	tokens, err := Scan(strings.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	expr, err := parse(tokens, limits.maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{
+		src:         src,
+		expr:        expr,
+		code:        compileBytecode(optimize(expr, interpreter), interpreter.functions),
+		interpreter: interpreter,
+	}, nil
+}
+
+// Source returns the source the program was compiled from.
+func (p *Program) Source() string {
+	return p.src
+}
+
+// Run evaluates the program against env. env may be nil if the program does
+// not refer to any variable. Programs run on a bytecode VM, which gives the
+// same results and errors as Interpreter.EvaluateEnv.
+func (p *Program) Run(env Env) (Value, error) {
+	return p.code.run(context.Background(), p.interpreter, env)
+}
+
+// RunContext is like Run, but fails with an Interrupted *LimitError as soon as
+// ctx is canceled or its deadline passes.
+func (p *Program) RunContext(ctx context.Context, env Env) (Value, error) {
+	return p.code.run(ctx, p.interpreter, env)
+}
+
+// Check checks the program against schema. See Interpreter.Check.
+func (p *Program) Check(schema Schema) (Type, []Diagnostic) {
+	return p.interpreter.Check(p.expr, schema)
+}
@@ -0,0 +1,156 @@
+package pock
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgram(t *testing.T) {
+	p, err := Compile("user.age >= 18 && user.country in countries")
+	require.NoError(t, err)
+	require.Equal(t, "user.age >= 18 && user.country in countries", p.Source())
+
+	type testCase struct {
+		env      map[string]any
+		expected bool
+	}
+	cases := []testCase{
+		{
+			env: map[string]any{
+				"user":      map[string]any{"age": 21, "country": "FR"},
+				"countries": []string{"FR", "DE"},
+			},
+			expected: true,
+		},
+		{
+			env: map[string]any{
+				"user":      map[string]any{"age": 17, "country": "FR"},
+				"countries": []string{"FR", "DE"},
+			},
+			expected: false,
+		},
+		{
+			env: map[string]any{
+				"user":      map[string]any{"age": 30, "country": "US"},
+				"countries": []string{"FR", "DE"},
+			},
+			expected: false,
+		},
+	}
+	for _, c := range cases {
+		env, err := NewMapEnv(c.env)
+		require.NoError(t, err)
+		val, err := p.Run(env)
+		require.NoError(t, err)
+		require.EqualValues(t, c.expected, val)
+	}
+}
+
+func TestProgramConcurrent(t *testing.T) {
+	p, err := Compile("n * 2 + len(name)")
+	require.NoError(t, err)
+
+	vals := make([]Value, 100)
+	errs := make([]error, 100)
+	var wg sync.WaitGroup
+	for n := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			env := MapEnv{"n": IntValue(n), "name": StringValue("pock")}
+			vals[n], errs[n] = p.Run(env)
+		}()
+	}
+	wg.Wait()
+
+	for n := range 100 {
+		require.NoError(t, errs[n])
+		require.EqualValues(t, n*2+4, vals[n])
+	}
+}
+
+func TestProgramFunc(t *testing.T) {
+	double := func(args []Value) (Value, error) {
+		return args[0].(IntValue) * 2, nil
+	}
+	p, err := Compile("double(n) + len(name)", WithFunc("double", 1, 1, double))
+	require.NoError(t, err)
+	val, err := p.Run(MapEnv{"n": IntValue(21), "name": StringValue("pock")})
+	require.NoError(t, err)
+	require.Equal(t, IntValue(46), val)
+
+	_, err = p.Run(MapEnv{"n": IntValue(21)})
+	require.Error(t, err)
+
+	p, err = Compile("double(1, 2)", WithFunc("double", 1, 1, double))
+	require.NoError(t, err)
+	_, err = p.Run(nil)
+	var runtimeErr *RuntimeError
+	require.ErrorAs(t, err, &runtimeErr)
+	require.Equal(t, ArityMismatch, runtimeErr.Kind)
+
+	typ, diags := p.Check(Schema{})
+	require.Len(t, diags, 1)
+	require.Equal(t, ArityMismatch, diags[0].Kind)
+	require.Equal(t, InvalidType, typ.Kind)
+
+	p, err = Compile("double(1)")
+	require.NoError(t, err)
+	_, err = p.Run(nil)
+	require.ErrorAs(t, err, &runtimeErr)
+	require.Equal(t, UnknownFunction, runtimeErr.Kind)
+}
+
+func TestProgramOptions(t *testing.T) {
+	p, err := Compile("n + 1", WithOverflowPromotion())
+	require.NoError(t, err)
+	val, err := p.Run(MapEnv{"n": IntValue(math.MaxInt64)})
+	require.NoError(t, err)
+	require.EqualValues(t, float64(math.MaxInt64)+1, val)
+}
+
+func TestProgramErrors(t *testing.T) {
+	var scanErr *ScanError
+	_, err := Compile("1 & 2")
+	require.ErrorAs(t, err, &scanErr)
+
+	var parseErr *ParseError
+	_, err = Compile("1 +")
+	require.ErrorAs(t, err, &parseErr)
+
+	p, err := Compile("missing + 1")
+	require.NoError(t, err)
+	_, err = p.Run(nil)
+	var runtimeErr *RuntimeError
+	require.True(t, errors.As(err, &runtimeErr))
+	require.Equal(t, UnknownVariable, runtimeErr.Kind)
+}
+
+func BenchmarkProgram(b *testing.B) {
+	for i := range 6 {
+		count := 1 << (i * 2)
+		b.Run(fmt.Sprint(count), func(b *testing.B) {
+			input := strings.Join(
+				slices.Repeat(
+					[]string{"(hello.world + 3 == 0) || (1.0 + 1 == 2.0)"},
+					count,
+				),
+				" && ",
+			)
+			p, _ := Compile(input)
+			env := MapEnv{"hello": MapValue{"world": IntValue(1138)}}
+
+			b.ResetTimer()
+			for range b.N {
+				benchmarkValue, _ = p.Run(env)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package pock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	valueType  = reflect.TypeFor[Value]()
+	timeType   = reflect.TypeFor[time.Time]()
+	numberType = reflect.TypeFor[json.Number]()
+)
+
+// loadReflect converts values that loadValue does not handle directly, using
+// reflection:
+//
+//   - pointers and interfaces are dereferenced, nil converts to null
+//   - named scalar types convert to their underlying type
+//   - slices and arrays convert to ListValue, nil slices to null
+//   - maps with string keys convert to MapValue, nil maps to null
+//   - structs convert to MapValue, see loadStruct
+//   - time.Time converts to a string, formatted as by encoding/json
+//   - json.Number converts to an integer if it has no fraction or exponent and
+//     fits in 64 bits, or else to a decimal
+//
+// seen holds the pointers, and the data pointers of the maps and slices, being
+// converted, to report cycles instead of recursing forever.
+func loadReflect(v reflect.Value, seen map[uintptr]bool) (Value, error) {
+	if !v.IsValid() {
+		return null, nil
+	}
+	if v.Type() == timeType || isValueType(v.Type()) {
+		if !v.CanInterface() {
+			return nil, fmt.Errorf("cannot access %s through an unexported field", v.Type())
+		}
+		if t, ok := v.Interface().(time.Time); ok {
+			return StringValue(t.Format(time.RFC3339Nano)), nil
+		}
+		return v.Interface().(Value), nil
+	}
+
+	if v.Type() == numberType {
+		return loadNumber(json.Number(v.String()))
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return BoolValue(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return IntValue(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return loadUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return DecimalValue(v.Float()), nil
+	case reflect.String:
+		return StringValue(v.String()), nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return null, nil
+		}
+		return loadReflect(v.Elem(), seen)
+	case reflect.Pointer:
+		if v.IsNil() {
+			return null, nil
+		}
+		seen, leave, err := enter(seen, v)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+		return loadReflect(v.Elem(), seen)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return null, nil
+			}
+			var leave func()
+			var err error
+			seen, leave, err = enter(seen, v)
+			if err != nil {
+				return nil, err
+			}
+			defer leave()
+		}
+		list := make(ListValue, v.Len())
+		for i := range v.Len() {
+			val, err := loadReflect(v.Index(i), seen)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = val
+		}
+		return list, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("invalid map key type: %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			return null, nil
+		}
+		seen, leave, err := enter(seen, v)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+		m := make(MapValue, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			val, err := loadReflect(iter.Value(), seen)
+			if err != nil {
+				return nil, err
+			}
+			m[iter.Key().String()] = val
+		}
+		return m, nil
+	case reflect.Struct:
+		m := MapValue{}
+		err := loadStruct(m, v, seen)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("invalid type: %s", v.Type())
+}
+
+// enter adds v, a pointer, a map or a slice, to seen, and returns seen and a
+// function removing v from it once converted. It returns an error if v is
+// already being converted. Empty slices are not added, as they may share their
+// data pointer with unrelated values.
+func enter(seen map[uintptr]bool, v reflect.Value) (map[uintptr]bool, func(), error) {
+	if v.Kind() == reflect.Slice && v.Len() == 0 {
+		return seen, func() {}, nil
+	}
+	ptr := v.Pointer()
+	if seen[ptr] {
+		return nil, nil, fmt.Errorf("cycle through %s", v.Type())
+	}
+	if seen == nil {
+		seen = map[uintptr]bool{}
+	}
+	seen[ptr] = true
+	return seen, func() { delete(seen, ptr) }, nil
+}
+
+// loadStruct adds the exported fields of the struct v to m. Fields are named
+// after their `pock` tag, or their `json` tag, or the name of the field, and
+// a field tagged "-" is skipped. The fields of embedded structs without a tag
+// are added as if they were fields of v, unless v has a field of the same
+// name.
+func loadStruct(m MapValue, v reflect.Value, seen map[uintptr]bool) error {
+	t := v.Type()
+	var embedded []reflect.Value
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType && !isValueType(ft) {
+				if !(fv.Kind() == reflect.Pointer && fv.IsNil()) {
+					embedded = append(embedded, fv)
+				}
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			name = field.Name
+		}
+		val, err := loadReflect(fv, seen)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t, field.Name, err)
+		}
+		m[name] = val
+	}
+
+	for _, fv := range embedded {
+		promoted, err := loadReflect(fv, seen)
+		if err != nil {
+			return err
+		}
+		for name, val := range promoted.(MapValue) {
+			if _, ok := m[name]; !ok {
+				m[name] = val
+			}
+		}
+	}
+	return nil
+}
+
+// isValueType reports whether values of type t can be used as a Value as is.
+// Pointers to values are dereferenced instead.
+func isValueType(t reflect.Type) bool {
+	return t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface && t.Implements(valueType)
+}
+
+// fieldName returns the name of field in expressions, or false if the field
+// is skipped. The name is empty for embedded fields without a tag name.
+func fieldName(field reflect.StructField) (string, bool) {
+	tag, ok := field.Tag.Lookup("pock")
+	if !ok {
+		tag = field.Tag.Get("json")
+	}
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name != "" {
+		return name, field.IsExported()
+	}
+	if field.Anonymous {
+		return "", true
+	}
+	return field.Name, field.IsExported()
+}
+
+// loadUint converts u to an IntValue, failing if it does not fit in an int64.
+func loadUint(u uint64) (Value, error) {
+	if u > math.MaxInt64 {
+		return nil, fmt.Errorf("integer overflow: %d", u)
+	}
+	return IntValue(u), nil
+}
+
+func loadNumber(n json.Number) (Value, error) {
+	if i, err := n.Int64(); err == nil {
+		return IntValue(i), nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid number: %s", n)
+	}
+	return DecimalValue(f), nil
+}
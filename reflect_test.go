@@ -0,0 +1,210 @@
+package pock
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testStatus string
+
+type testAddress struct {
+	City    string `json:"city"`
+	Country string `json:"country,omitempty"`
+}
+
+type testEntity struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type testAudit struct {
+	By string
+}
+
+type testUser struct {
+	testEntity
+	*testAudit
+
+	Name     string            `pock:"name" json:"full_name"`
+	Age      uint8             `json:"age"`
+	Score    float32           `json:"score"`
+	Status   testStatus        `json:"status"`
+	Address  *testAddress      `json:"address"`
+	Previous []testAddress     `json:"previous"`
+	Tags     map[string]string `json:"tags"`
+	Manager  *testUser         `json:"manager"`
+	Password string            `json:"-"`
+	Raw      Value             `json:"raw"`
+	internal string
+}
+
+func TestInterpreterLoadValue(t *testing.T) {
+	manager := &testUser{Name: "Ada"}
+	user := testUser{
+		testEntity: testEntity{
+			ID:        1138,
+			CreatedAt: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+		},
+		testAudit: &testAudit{By: "admin"},
+		Name:      "Grace",
+		Age:       42,
+		Score:     0.5,
+		Status:    "active",
+		Address:   &testAddress{City: "Paris", Country: "FR"},
+		Previous:  []testAddress{{City: "Lyon"}, {City: "Nice"}},
+		Tags:      map[string]string{"team": "core"},
+		Manager:   manager,
+		Password:  "secret",
+		Raw:       IntValue(7),
+		internal:  "hidden",
+	}
+
+	i := NewInterpreter()
+	require.NoError(t, i.LoadValue("user", user))
+	require.NoError(t, i.LoadValue("ptr", &user))
+	require.NoError(t, i.LoadValue("users", []*testUser{&user, manager}))
+	require.NoError(t, i.LoadValue("byName", map[string]testAddress{"home": {City: "Paris"}}))
+	require.NoError(t, i.LoadValue("nothing", (*testUser)(nil)))
+
+	type testCase struct {
+		input    string
+		expected any
+	}
+	cases := []testCase{
+		{input: "user.id", expected: 1138},
+		{input: "user.created_at", expected: "2024-03-01T12:30:00Z"},
+		{input: "user.By", expected: "admin"},
+		{input: "user.name", expected: "Grace"},
+		{input: "user.age", expected: 42},
+		{input: "user.score", expected: 0.5},
+		{input: `user.status == "active"`, expected: true},
+		{input: "user.address.city", expected: "Paris"},
+		{input: "user.previous[1].city", expected: "Nice"},
+		{input: `user.previous[0].country == ""`, expected: true},
+		{input: "user.tags.team", expected: "core"},
+		{input: "user.manager.name", expected: "Ada"},
+		{input: "user.manager.address", expected: null},
+		{input: "user.manager.previous", expected: null},
+		{input: "user.raw", expected: 7},
+		{input: `"Password" in user || "internal" in user`, expected: false},
+		{input: `"testEntity" in user || "testAudit" in user`, expected: false},
+		{input: "ptr.name", expected: "Grace"},
+		{input: "users[1].name", expected: "Ada"},
+		{input: "byName.home.city", expected: "Paris"},
+		{input: "nothing", expected: null},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			expr, err := Parse(tokens)
+			require.NoError(t, err)
+			val, err := i.Evaluate(expr)
+			require.NoError(t, err)
+			require.EqualValues(t, c.expected, val)
+		})
+	}
+}
+
+func TestInterpreterLoadValueShadowing(t *testing.T) {
+	type inner struct {
+		Name string
+		Kind string
+	}
+	type outer struct {
+		inner
+		Name string
+	}
+
+	val, err := loadValue(outer{inner: inner{Name: "inner", Kind: "kind"}, Name: "outer"})
+	require.NoError(t, err)
+	require.Equal(t, MapValue{"Name": StringValue("outer"), "Kind": StringValue("kind")}, val)
+}
+
+func TestInterpreterLoadNumber(t *testing.T) {
+	cases := map[json.Number]Value{
+		"1138":                  IntValue(1138),
+		"-7":                    IntValue(-7),
+		"1.5":                   DecimalValue(1.5),
+		"1e2":                   DecimalValue(100),
+		"1.0":                   DecimalValue(1),
+		"100000000000000000000": DecimalValue(1e20),
+	}
+	for n, expected := range cases {
+		t.Run(string(n), func(t *testing.T) {
+			val, err := loadValue(n)
+			require.NoError(t, err)
+			require.Equal(t, expected, val)
+		})
+	}
+
+	var state map[string]any
+	dec := json.NewDecoder(strings.NewReader(`{"n": 30, "xs": [1, 2.5]}`))
+	dec.UseNumber()
+	require.NoError(t, dec.Decode(&state))
+	env, err := NewMapEnv(state)
+	require.NoError(t, err)
+	require.Equal(t, MapEnv{"n": IntValue(30), "xs": ListValue{IntValue(1), DecimalValue(2.5)}}, env)
+}
+
+func TestInterpreterLoadValueError(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	cycle := &node{}
+	cycle.Next = cycle
+	type M map[string]any
+	mapCycle := M{}
+	mapCycle["self"] = mapCycle
+	type S []any
+	sliceCycle := S{nil}
+	sliceCycle[0] = sliceCycle
+	anyMapCycle := map[string]any{}
+	anyMapCycle["a"] = []any{anyMapCycle}
+	anySliceCycle := []any{nil}
+	anySliceCycle[0] = map[string]any{"self": anySliceCycle}
+
+	cases := map[string]any{
+		"func":     func() {},
+		"chan":     make(chan int),
+		"complex":  complex(1, 2),
+		"key":      map[int]string{1: "one"},
+		"field":    struct{ F func() }{},
+		"cycle":    cycle,
+		"map":      mapCycle,
+		"slice":    sliceCycle,
+		"anyMap":   anyMapCycle,
+		"anySlice": anySliceCycle,
+		"uint64":   uint64(math.MaxUint64),
+		"uint":     uint(math.MaxInt64 + 1),
+		"named":    struct{ N uint64 }{N: math.MaxInt64 + 1},
+		"number":   json.Number("one"),
+	}
+	for name, value := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := NewInterpreter().LoadValue(name, value)
+			require.Error(t, err)
+		})
+	}
+
+	val, err := loadValue(uint64(math.MaxInt64))
+	require.NoError(t, err)
+	require.Equal(t, IntValue(math.MaxInt64), val)
+
+	// The same map or slice may appear several times, as long as it is not
+	// nested in itself.
+	shared := map[string]any{"a": 1}
+	list := []any{2}
+	val, err = loadValue(map[string]any{"x": shared, "y": shared, "l": []any{list, list}})
+	require.NoError(t, err)
+	require.Equal(t, MapValue{
+		"x": MapValue{"a": IntValue(1)},
+		"y": MapValue{"a": IntValue(1)},
+		"l": ListValue{ListValue{IntValue(2)}, ListValue{IntValue(2)}},
+	}, val)
+}
@@ -7,7 +7,10 @@ import (
 	"io"
 	"slices"
 	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 type TokenType int
@@ -33,17 +36,29 @@ const (
 	Minus
 	Star
 	Slash
+	Percent
+	StarStar
 	Not
 
 	// Misc
 	LeftParen
 	RightParen
+	LeftBracket
+	RightBracket
+	LeftBrace
+	RightBrace
 	Dot
+	Comma
+	Question
+	QuestionDot
+	QuestionQuestion
+	Colon
 
 	// Keywords
 	True
 	False
 	Null
+	In
 
 	// Literal types
 	Integer
@@ -80,20 +95,44 @@ func (tt TokenType) String() string {
 		return "Star"
 	case Slash:
 		return "Slash"
+	case Percent:
+		return "Percent"
+	case StarStar:
+		return "StarStar"
 	case Not:
 		return "Not"
 	case LeftParen:
 		return "LeftParen"
 	case RightParen:
 		return "RightParen"
+	case LeftBracket:
+		return "LeftBracket"
+	case RightBracket:
+		return "RightBracket"
+	case LeftBrace:
+		return "LeftBrace"
+	case RightBrace:
+		return "RightBrace"
 	case Dot:
 		return "Dot"
+	case Comma:
+		return "Comma"
+	case Question:
+		return "Question"
+	case QuestionDot:
+		return "QuestionDot"
+	case QuestionQuestion:
+		return "QuestionQuestion"
+	case Colon:
+		return "Colon"
 	case True:
 		return "True"
 	case False:
 		return "False"
 	case Null:
 		return "Null"
+	case In:
+		return "In"
 	case Integer:
 		return "Integer"
 	case Decimal:
@@ -110,13 +149,84 @@ func (tt TokenType) GoString() string {
 	return tt.String()
 }
 
-var reservedRunes = []rune{'|', '&', '<', '>', '=', '+', '-', '*', '/', '!', '"', '.', '(', ')'}
+// operatorLexeme returns the source text of an operator token type, for use in
+// error messages.
+func operatorLexeme(tt TokenType) string {
+	switch tt {
+	case Or:
+		return "||"
+	case And:
+		return "&&"
+	case Lt:
+		return "<"
+	case Lte:
+		return "<="
+	case Gt:
+		return ">"
+	case Gte:
+		return ">="
+	case Eq:
+		return "=="
+	case Neq:
+		return "!="
+	case Plus:
+		return "+"
+	case Minus:
+		return "-"
+	case Star:
+		return "*"
+	case Slash:
+		return "/"
+	case Percent:
+		return "%"
+	case StarStar:
+		return "**"
+	case Not:
+		return "!"
+	case In:
+		return "in"
+	case QuestionQuestion:
+		return "??"
+	case RightParen:
+		return ")"
+	case RightBracket:
+		return "]"
+	case RightBrace:
+		return "}"
+	}
+	return tt.String()
+}
+
+var reservedRunes = []rune{'|', '&', '<', '>', '=', '+', '-', '*', '/', '%', '!', '"', '\'', '`', '.', ',', '?', ':', '(', ')', '[', ']', '{', '}'}
 
 var whitespaceError = errors.New("whitespace")
 
+// Position is a location in the source. Offset is a 0-based byte offset, Line
+// and Column are 1-based, and Column counts runes.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is the range of source between Start (inclusive) and End (exclusive).
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) String() string {
+	return s.Start.String()
+}
+
 type Token struct {
 	Type   TokenType
 	Lexeme string
+	Span   Span
 
 	IntegerValue    int64
 	DecimalValue    float64
@@ -128,31 +238,79 @@ type scanner struct {
 	io.RuneScanner
 
 	buf *bytes.Buffer
+
+	pos  Position
+	prev Position
+
+	// last is the type of the last token scanned, or Invalid at the start of
+	// the source.
+	last TokenType
+
+	// pending is a token scanned ahead of the current one, to be returned
+	// next.
+	pending *Token
 }
 
-func (s scanner) advance() (rune, error) {
+func (s *scanner) advance() (rune, error) {
 	r, sz, err := s.ReadRune()
 	if err != nil {
 		return 0, err
 	}
 	if r == 0xfffd && sz == 1 {
-		return 0, fmt.Errorf("invalid UTF-8 sequence")
+		return 0, &ScanError{
+			Span: Span{Start: s.pos, End: s.pos},
+			Msg:  "invalid UTF-8 sequence",
+		}
 	}
 	s.buf.WriteRune(r)
+	s.prev = s.pos
+	s.pos.Offset += sz
+	if r == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
 	return r, nil
 }
 
-func (s scanner) backtrack() error {
-	l := s.buf.Len()
+func (s *scanner) backtrack() error {
 	err := s.UnreadRune()
 	if err != nil {
 		return err
 	}
-	s.buf.Truncate(l - 1)
+	s.buf.Truncate(s.buf.Len() - (s.pos.Offset - s.prev.Offset))
+	s.pos = s.prev
 	return nil
 }
 
-func (s scanner) match(expected rune) (bool, error) {
+func (s *scanner) errorf(start Position, format string, args ...any) *ScanError {
+	return &ScanError{
+		Span: Span{Start: start, End: s.pos},
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (s *scanner) wrapError(start Position, msg string, err error) *ScanError {
+	return &ScanError{
+		Span: Span{Start: start, End: s.pos},
+		Msg:  fmt.Sprintf("%s: `%s`", msg, err),
+		Err:  err,
+	}
+}
+
+// unexpectedEOF reports a token that is still open at the end of the source.
+// The error wraps io.ErrUnexpectedEOF, so that callers reading the source
+// line by line can tell that more input is needed.
+func (s *scanner) unexpectedEOF(start Position, msg string) *ScanError {
+	return &ScanError{
+		Span: Span{Start: start, End: s.pos},
+		Msg:  msg,
+		Err:  io.ErrUnexpectedEOF,
+	}
+}
+
+func (s *scanner) match(expected rune) (bool, error) {
 	r, err := s.advance()
 	if err != nil {
 		return false, err
@@ -171,7 +329,11 @@ func (s scanner) match(expected rune) (bool, error) {
 func Scan(rs io.RuneScanner) ([]Token, error) {
 	var tok Token
 	var err error
-	s := scanner{RuneScanner: rs, buf: new(bytes.Buffer)}
+	s := &scanner{
+		RuneScanner: rs,
+		buf:         new(bytes.Buffer),
+		pos:         Position{Line: 1, Column: 1},
+	}
 	tokens := make([]Token, 0)
 
 	for err == nil || err == whitespaceError {
@@ -188,9 +350,31 @@ func Scan(rs io.RuneScanner) ([]Token, error) {
 	return tokens, nil
 }
 
-func scanToken(s scanner) (Token, error) {
+func scanToken(s *scanner) (Token, error) {
 	defer s.buf.Reset()
 
+	if s.pending != nil {
+		tok := *s.pending
+		s.pending = nil
+		s.last = tok.Type
+		return tok, nil
+	}
+
+	start := s.pos
+	tok, err := scanRawToken(s, start)
+	if err != nil {
+		return Token{}, err
+	}
+	end := s.pos
+	if s.pending != nil {
+		end = s.pending.Span.Start
+	}
+	tok.Span = Span{Start: start, End: end}
+	s.last = tok.Type
+	return tok, nil
+}
+
+func scanRawToken(s *scanner, start Position) (Token, error) {
 	r, err := s.advance()
 	if err != nil {
 		return Token{}, err
@@ -202,15 +386,108 @@ func scanToken(s scanner) (Token, error) {
 	case '-':
 		return Token{Type: Minus, Lexeme: s.buf.String()}, nil
 	case '*':
+		ok, err := s.match('*')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Token{}, err
+		}
+		if ok {
+			return Token{Type: StarStar, Lexeme: s.buf.String()}, nil
+		}
 		return Token{Type: Star, Lexeme: s.buf.String()}, nil
 	case '/':
+		ok, err := s.match('/')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Token{}, err
+		}
+		if ok {
+			for r, err = s.advance(); r != '\n' && err == nil; r, err = s.advance() {
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return Token{}, err
+			}
+			return Token{}, whitespaceError
+		}
+		ok, err = s.match('*')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Token{}, err
+		}
+		if ok {
+			return Token{}, scanBlockComment(s, start)
+		}
 		return Token{Type: Slash, Lexeme: s.buf.String()}, nil
+	case '%':
+		return Token{Type: Percent, Lexeme: s.buf.String()}, nil
 	case '(':
 		return Token{Type: LeftParen, Lexeme: s.buf.String()}, nil
 	case ')':
 		return Token{Type: RightParen, Lexeme: s.buf.String()}, nil
+	case '[':
+		return Token{Type: LeftBracket, Lexeme: s.buf.String()}, nil
+	case ']':
+		return Token{Type: RightBracket, Lexeme: s.buf.String()}, nil
+	case '{':
+		return Token{Type: LeftBrace, Lexeme: s.buf.String()}, nil
+	case '}':
+		return Token{Type: RightBrace, Lexeme: s.buf.String()}, nil
 	case '.':
+		// After an operand, `.` is always member access, so that `xs[0].1`
+		// is not scanned as `xs[0]` followed by the decimal `.1`.
+		if endsOperand(s.last) {
+			return Token{Type: Dot, Lexeme: s.buf.String()}, nil
+		}
+		r, err := s.advance()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Token{}, err
+		}
+		if err == nil && isDigit(r) {
+			return scanNumber(s, start)
+		}
+		if err == nil {
+			_ = s.backtrack()
+		}
 		return Token{Type: Dot, Lexeme: s.buf.String()}, nil
+	case ',':
+		return Token{Type: Comma, Lexeme: s.buf.String()}, nil
+	case '?':
+		ok, err := s.match('?')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Token{}, err
+		}
+		if ok {
+			return Token{Type: QuestionQuestion, Lexeme: s.buf.String()}, nil
+		}
+		dot := s.pos
+		ok, err = s.match('.')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Token{}, err
+		}
+		if ok {
+			// As in JavaScript, `?.` followed by a digit is `?` followed by
+			// a decimal, so that `p ?.5 : 1` is a conditional.
+			r, err := s.advance()
+			if err != nil && !errors.Is(err, io.EOF) {
+				return Token{}, err
+			}
+			if err == nil && isDigit(r) {
+				s.buf.Reset()
+				s.buf.WriteString(".")
+				s.buf.WriteRune(r)
+				num, err := scanNumber(s, dot)
+				if err != nil {
+					return Token{}, err
+				}
+				num.Span = Span{Start: dot, End: s.pos}
+				s.pending = &num
+				return Token{Type: Question, Lexeme: "?"}, nil
+			}
+			if err == nil {
+				_ = s.backtrack()
+			}
+			return Token{Type: QuestionDot, Lexeme: s.buf.String()}, nil
+		}
+		return Token{Type: Question, Lexeme: s.buf.String()}, nil
+	case ':':
+		return Token{Type: Colon, Lexeme: s.buf.String()}, nil
 	case '|':
 		ok, err := s.match('|')
 		if err != nil && !errors.Is(err, io.EOF) {
@@ -219,7 +496,7 @@ func scanToken(s scanner) (Token, error) {
 		if ok {
 			return Token{Type: Or, Lexeme: s.buf.String()}, nil
 		}
-		return Token{}, fmt.Errorf("expected `|` after `|`")
+		return Token{}, s.errorf(start, "expected `|` after `|`")
 	case '&':
 		ok, err := s.match('&')
 		if err != nil && !errors.Is(err, io.EOF) {
@@ -228,7 +505,7 @@ func scanToken(s scanner) (Token, error) {
 		if ok {
 			return Token{Type: And, Lexeme: s.buf.String()}, nil
 		}
-		return Token{}, fmt.Errorf("expected `&` after `&`")
+		return Token{}, s.errorf(start, "expected `&` after `&`")
 	case '=':
 		ok, err := s.match('=')
 		if err != nil && !errors.Is(err, io.EOF) {
@@ -237,7 +514,7 @@ func scanToken(s scanner) (Token, error) {
 		if ok {
 			return Token{Type: Eq, Lexeme: s.buf.String()}, nil
 		}
-		return Token{}, fmt.Errorf("expected `=` after `=`")
+		return Token{}, s.errorf(start, "expected `=` after `=`")
 	case '!':
 		ok, err := s.match('=')
 		if err != nil && !errors.Is(err, io.EOF) {
@@ -265,12 +542,14 @@ func scanToken(s scanner) (Token, error) {
 			return Token{Type: Gte, Lexeme: s.buf.String()}, nil
 		}
 		return Token{Type: Gt, Lexeme: s.buf.String()}, nil
-	case '"':
-		for r, err = s.advance(); r != '"' && err == nil; r, err = s.advance() {
+	case '"', '\'':
+		return scanString(s, start, r)
+	case '`':
+		for r, err = s.advance(); r != '`' && err == nil; r, err = s.advance() {
 		}
 		if err != nil {
 			if errors.Is(err, io.EOF) {
-				return Token{}, fmt.Errorf("unterminated string")
+				return Token{}, s.unexpectedEOF(start, "unterminated raw string")
 			}
 			return Token{}, err
 		}
@@ -282,40 +561,7 @@ func scanToken(s scanner) (Token, error) {
 		}, nil
 	default:
 		if isDigit(r) {
-			isDecimal := false
-			for r, err = s.advance(); (isDigit(r) || r == '.') && err == nil; r, err = s.advance() {
-				if r == '.' {
-					isDecimal = true
-				}
-			}
-			if err != nil && !errors.Is(err, io.EOF) {
-				return Token{}, err
-			}
-			if !errors.Is(err, io.EOF) {
-				_ = s.backtrack()
-			}
-			lex := s.buf.String()
-			if isDecimal {
-				val, err := strconv.ParseFloat(lex, 64)
-				if err != nil {
-					return Token{}, fmt.Errorf("invalid number: `%w`", err)
-				}
-				return Token{
-					Type:         Decimal,
-					Lexeme:       lex,
-					DecimalValue: val,
-				}, nil
-			} else {
-				val, err := strconv.ParseInt(lex, 10, 64)
-				if err != nil {
-					return Token{}, fmt.Errorf("invalid number: `%w`", err)
-				}
-				return Token{
-					Type:         Integer,
-					Lexeme:       lex,
-					IntegerValue: val,
-				}, nil
-			}
+			return scanNumber(s, start)
 		}
 		if unicode.IsSpace(r) {
 			for r, err = s.advance(); unicode.IsSpace(r) && err == nil; r, err = s.advance() {
@@ -345,12 +591,281 @@ func scanToken(s scanner) (Token, error) {
 			return Token{Type: False, Lexeme: lex}, nil
 		case "null":
 			return Token{Type: Null, Lexeme: lex}, nil
+		case "in":
+			return Token{Type: In, Lexeme: lex}, nil
 		default:
 			return Token{Type: Identifier, Lexeme: lex, IdentifierValue: lex}, nil
 		}
 	}
 }
 
+// scanBlockComment skips the rest of a `/* */` comment. Comments do not nest.
+func scanBlockComment(s *scanner, start Position) error {
+	star := false
+	for {
+		r, err := s.advance()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return s.unexpectedEOF(start, "unterminated comment")
+			}
+			return err
+		}
+		if star && r == '/' {
+			return whitespaceError
+		}
+		star = r == '*'
+	}
+}
+
+// scanNumber scans the rest of a numeric literal whose first rune has already
+// been read. Every rune that may belong to the literal is consumed before the
+// literal is validated, so that malformed forms such as `1.2.3` or `0b102` are
+// reported as a whole rather than split into several tokens.
+//
+// Integer literals must fit in an int64. As `-` is an operator rather than part
+// of the literal, the minimum int64 cannot be written as a literal: it is
+// written `-9223372036854775807 - 1` instead.
+func scanNumber(s *scanner, start Position) (Token, error) {
+	for {
+		prev := s.buf.String()
+		r, err := s.advance()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Token{}, err
+		}
+		if !continuesNumber(prev, r) {
+			_ = s.backtrack()
+			break
+		}
+	}
+
+	lex := s.buf.String()
+	base, prefix := 10, ""
+	if len(lex) > 1 && lex[0] == '0' {
+		switch lex[1] {
+		case 'x', 'X':
+			base, prefix = 16, lex[:2]
+		case 'o', 'O':
+			base, prefix = 8, lex[:2]
+		case 'b', 'B':
+			base, prefix = 2, lex[:2]
+		}
+	}
+
+	digits := lex[len(prefix):]
+	if digits == "" {
+		return Token{}, s.errorf(start, "missing digits after `%s`", prefix)
+	}
+	for i, r := range digits {
+		i += len(prefix)
+		switch {
+		case r == '_':
+			if !isBaseDigit(lex, i-1, base) || !isBaseDigit(lex, i+1, base) {
+				return Token{}, numberError(start, i, "`_` must separate digits")
+			}
+		case base == 10 && (r == '.' || r == 'e' || r == 'E' || r == '+' || r == '-'):
+		case !isBaseDigit(lex, i, base):
+			return Token{}, numberError(start, i, "invalid digit `%c` in %s literal", r, baseName(base))
+		}
+	}
+	if base == 10 && strings.ContainsAny(lex[len(lex)-1:], "eE+-") {
+		return Token{}, s.errorf(start, "missing digits in exponent")
+	}
+	digits = strings.ReplaceAll(digits, "_", "")
+
+	if base == 10 && strings.ContainsAny(digits, ".eE") {
+		val, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			return Token{}, s.wrapError(start, "invalid number", err)
+		}
+		return Token{Type: Decimal, Lexeme: lex, DecimalValue: val}, nil
+	}
+	val, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return Token{}, s.wrapError(start, "invalid number", err)
+	}
+	return Token{Type: Integer, Lexeme: lex, IntegerValue: val}, nil
+}
+
+// endsOperand reports whether a token of type tt may be the last token of an
+// operand.
+func endsOperand(tt TokenType) bool {
+	switch tt {
+	case RightParen, RightBracket, RightBrace, True, False, Null, Integer, Decimal, String, Identifier:
+		return true
+	}
+	return false
+}
+
+// continuesNumber reports whether r may follow lex in a numeric literal.
+func continuesNumber(lex string, r rune) bool {
+	if isDigit(r) || r == '_' || r == '.' {
+		return true
+	}
+	if lex == "0" {
+		return strings.ContainsRune("xXoObBeE", r)
+	}
+	if len(lex) > 1 && lex[0] == '0' && (lex[1] == 'x' || lex[1] == 'X') {
+		_, ok := hexDigit(r)
+		return ok
+	}
+	if len(lex) > 1 && lex[0] == '0' && strings.ContainsRune("oObB", rune(lex[1])) {
+		return false
+	}
+	if r == 'e' || r == 'E' {
+		return true
+	}
+	last := lex[len(lex)-1]
+	return (r == '+' || r == '-') && (last == 'e' || last == 'E')
+}
+
+// isBaseDigit reports whether the byte at index i of lex is a digit in base.
+func isBaseDigit(lex string, i int, base int) bool {
+	if i < 0 || i >= len(lex) {
+		return false
+	}
+	d, ok := hexDigit(rune(lex[i]))
+	return ok && int(d) < base
+}
+
+func baseName(base int) string {
+	switch base {
+	case 16:
+		return "hexadecimal"
+	case 8:
+		return "octal"
+	case 2:
+		return "binary"
+	}
+	return "decimal"
+}
+
+// numberError reports an error on the byte at index i of the numeric literal
+// starting at start. Numeric literals are ASCII and never span several lines.
+func numberError(start Position, i int, format string, args ...any) *ScanError {
+	pos := Position{Offset: start.Offset + i, Line: start.Line, Column: start.Column + i}
+	end := Position{Offset: pos.Offset + 1, Line: pos.Line, Column: pos.Column + 1}
+	return &ScanError{
+		Span: Span{Start: pos, End: end},
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// scanString scans a string delimited by quote, decoding escape sequences.
+func scanString(s *scanner, start Position, quote rune) (Token, error) {
+	var val strings.Builder
+	for {
+		r, err := s.advance()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return Token{}, s.unexpectedEOF(start, "unterminated string")
+			}
+			return Token{}, err
+		}
+		if r == quote {
+			break
+		}
+		if r != '\\' {
+			val.WriteRune(r)
+			continue
+		}
+
+		escStart := s.prev
+		r, err = s.advance()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return Token{}, s.unexpectedEOF(start, "unterminated string")
+			}
+			return Token{}, err
+		}
+		switch r {
+		case '"', '\'', '\\':
+			val.WriteRune(r)
+		case 'n':
+			val.WriteRune('\n')
+		case 't':
+			val.WriteRune('\t')
+		case 'r':
+			val.WriteRune('\r')
+		case 'u':
+			r, err := scanUnicodeEscape(s, escStart)
+			if err != nil {
+				return Token{}, err
+			}
+			if utf16.IsSurrogate(r) {
+				r, err = scanLowSurrogate(s, escStart, r)
+				if err != nil {
+					return Token{}, err
+				}
+			}
+			val.WriteRune(r)
+		default:
+			return Token{}, s.errorf(escStart, "invalid escape sequence `\\%c`", r)
+		}
+	}
+
+	return Token{
+		Type:        String,
+		Lexeme:      s.buf.String(),
+		StringValue: val.String(),
+	}, nil
+}
+
+// scanUnicodeEscape scans the 4 hexadecimal digits following `\u`.
+func scanUnicodeEscape(s *scanner, escStart Position) (rune, error) {
+	var code rune
+	for range 4 {
+		r, err := s.advance()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		digit, ok := hexDigit(r)
+		if err != nil || !ok {
+			return 0, s.errorf(escStart, "invalid Unicode escape sequence")
+		}
+		code = code<<4 | digit
+	}
+	return code, nil
+}
+
+// scanLowSurrogate scans the `\uXXXX` escape completing the UTF-16 surrogate
+// pair started by high.
+func scanLowSurrogate(s *scanner, escStart Position, high rune) (rune, error) {
+	ok, err := s.match('\\')
+	if err == nil && ok {
+		ok, err = s.match('u')
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	if !ok {
+		return 0, s.errorf(escStart, "invalid Unicode surrogate pair")
+	}
+	low, err := scanUnicodeEscape(s, escStart)
+	if err != nil {
+		return 0, err
+	}
+	r := utf16.DecodeRune(high, low)
+	if r == utf8.RuneError {
+		return 0, s.errorf(escStart, "invalid Unicode surrogate pair")
+	}
+	return r, nil
+}
+
+func hexDigit(r rune) (rune, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return r - '0', true
+	case r >= 'a' && r <= 'f':
+		return r - 'a' + 10, true
+	case r >= 'A' && r <= 'F':
+		return r - 'A' + 10, true
+	}
+	return 0, false
+}
+
 func isDigit(r rune) bool {
 	return r >= '0' && r <= '9'
 }
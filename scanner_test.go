@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/gkampitakis/go-snaps/snaps"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,13 +35,25 @@ func TestScannerTokenType(t *testing.T) {
 		{name: "Minus", input: "-", expected: Minus},
 		{name: "Star", input: "*", expected: Star},
 		{name: "Slash", input: "/", expected: Slash},
+		{name: "Percent", input: "%", expected: Percent},
+		{name: "StarStar", input: "**", expected: StarStar},
 		{name: "Not", input: "!", expected: Not},
 		{name: "LeftParen", input: "(", expected: LeftParen},
 		{name: "RightParen", input: ")", expected: RightParen},
+		{name: "LeftBracket", input: "[", expected: LeftBracket},
+		{name: "RightBracket", input: "]", expected: RightBracket},
+		{name: "LeftBrace", input: "{", expected: LeftBrace},
+		{name: "RightBrace", input: "}", expected: RightBrace},
 		{name: "Dot", input: ".", expected: Dot},
+		{name: "Comma", input: ",", expected: Comma},
+		{name: "Question", input: "?", expected: Question},
+		{name: "QuestionDot", input: "?.", expected: QuestionDot},
+		{name: "QuestionQuestion", input: "??", expected: QuestionQuestion},
+		{name: "Colon", input: ":", expected: Colon},
 		{name: "True", input: "true", expected: True},
 		{name: "False", input: "false", expected: False},
 		{name: "Null", input: "null", expected: Null},
+		{name: "In", input: "in", expected: In},
 		{name: "Integer", input: "123", expected: Integer},
 		{name: "Decimal", input: "123.45", expected: Decimal},
 		{name: "String", input: `"Hello World!"`, expected: String},
@@ -70,12 +83,87 @@ func TestScannerDecimalValue(t *testing.T) {
 	require.EqualValues(t, 123.45, tokens[0].DecimalValue)
 }
 
+func TestScannerNumberLiterals(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected Token
+	}
+	cases := []testCase{
+		{input: "1_000_000", expected: Token{Type: Integer, IntegerValue: 1000000}},
+		{input: "0xFF", expected: Token{Type: Integer, IntegerValue: 255}},
+		{input: "0Xff", expected: Token{Type: Integer, IntegerValue: 255}},
+		{input: "0xdead_beef", expected: Token{Type: Integer, IntegerValue: 0xdeadbeef}},
+		{input: "0o755", expected: Token{Type: Integer, IntegerValue: 0o755}},
+		{input: "0b1010", expected: Token{Type: Integer, IntegerValue: 10}},
+		{input: "0755", expected: Token{Type: Integer, IntegerValue: 755}},
+		{input: "0", expected: Token{Type: Integer, IntegerValue: 0}},
+		{input: "1e6", expected: Token{Type: Decimal, DecimalValue: 1e6}},
+		{input: "1E6", expected: Token{Type: Decimal, DecimalValue: 1e6}},
+		{input: "0e5", expected: Token{Type: Decimal, DecimalValue: 0}},
+		{input: "0E-1", expected: Token{Type: Decimal, DecimalValue: 0}},
+		{input: "0.5e1", expected: Token{Type: Decimal, DecimalValue: 5}},
+		{input: "2.5e-3", expected: Token{Type: Decimal, DecimalValue: 2.5e-3}},
+		{input: "2.5e+3", expected: Token{Type: Decimal, DecimalValue: 2.5e3}},
+		{input: "1_000.000_1", expected: Token{Type: Decimal, DecimalValue: 1000.0001}},
+		{input: ".5", expected: Token{Type: Decimal, DecimalValue: 0.5}},
+		{input: ".5e1", expected: Token{Type: Decimal, DecimalValue: 5}},
+		{input: "1.", expected: Token{Type: Decimal, DecimalValue: 1}},
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			require.Len(t, tokens, 1)
+			c.expected.Lexeme = c.input
+			c.expected.Span = tokens[0].Span
+			require.Equal(t, c.expected, tokens[0])
+		})
+	}
+}
+
 func TestScannerStringValue(t *testing.T) {
 	tokens, err := Scan(strings.NewReader(`"Hello World!"`))
 	require.NoError(t, err)
 	require.EqualValues(t, "Hello World!", tokens[0].StringValue)
 }
 
+func TestScannerStringEscapes(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected string
+	}
+	cases := []testCase{
+		{input: `"say \"hi\""`, expected: `say "hi"`},
+		{input: `"back\\slash"`, expected: `back\slash`},
+		{input: `"line\nbreak"`, expected: "line\nbreak"},
+		{input: `"tab\tand\rreturn"`, expected: "tab\tand\rreturn"},
+		{input: `"caf\u00e9"`, expected: "café"},
+		{input: `"\u00C9t\u00e9"`, expected: "Été"},
+		{input: `"\ud83d\ude00"`, expected: "😀"},
+		{input: `"it\'s"`, expected: "it's"},
+		{input: `'single'`, expected: "single"},
+		{input: `'say "hi"'`, expected: `say "hi"`},
+		{input: `'it\'s'`, expected: "it's"},
+		{input: "`raw \\n \"string\"`", expected: `raw \n "string"`},
+		{input: "`multi\nline`", expected: "multi\nline"},
+		{input: "``", expected: ""},
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			require.Len(t, tokens, 1)
+			require.Equal(t, String, tokens[0].Type)
+			require.Equal(t, c.input, tokens[0].Lexeme)
+			require.Equal(t, c.expected, tokens[0].StringValue)
+		})
+	}
+}
+
 func TestScannerIdentifierValue(t *testing.T) {
 	tokens, err := Scan(strings.NewReader("hello_world"))
 	require.NoError(t, err)
@@ -123,6 +211,30 @@ func TestScannerSequence(t *testing.T) {
 				{Type: True},
 			},
 		},
+		{
+			input: "p ?.5 : .25",
+			expected: []Token{
+				{Type: Identifier, IdentifierValue: "p"},
+				{Type: Question},
+				{Type: Decimal, DecimalValue: 0.5},
+				{Type: Colon},
+				{Type: Decimal, DecimalValue: 0.25},
+			},
+		},
+		{
+			input: "a?.b ?? a?.[0]",
+			expected: []Token{
+				{Type: Identifier, IdentifierValue: "a"},
+				{Type: QuestionDot},
+				{Type: Identifier, IdentifierValue: "b"},
+				{Type: QuestionQuestion},
+				{Type: Identifier, IdentifierValue: "a"},
+				{Type: QuestionDot},
+				{Type: LeftBracket},
+				{Type: Integer, IntegerValue: 0},
+				{Type: RightBracket},
+			},
+		},
 	}
 
 	t.Parallel()
@@ -137,6 +249,64 @@ func TestScannerSequence(t *testing.T) {
 	}
 }
 
+func TestScannerSpans(t *testing.T) {
+	tokens, err := Scan(strings.NewReader("héllo <=\n\t42"))
+	require.NoError(t, err)
+	require.Len(t, tokens, 3)
+	require.Equal(t, Span{Start: Position{0, 1, 1}, End: Position{6, 1, 6}}, tokens[0].Span)
+	require.Equal(t, Span{Start: Position{7, 1, 7}, End: Position{9, 1, 9}}, tokens[1].Span)
+	require.Equal(t, Span{Start: Position{11, 2, 2}, End: Position{13, 2, 4}}, tokens[2].Span)
+
+	tokens, err = Scan(strings.NewReader("p?.5e1:1"))
+	require.NoError(t, err)
+	require.Len(t, tokens, 5)
+	require.Equal(t, Span{Start: Position{1, 1, 2}, End: Position{2, 1, 3}}, tokens[1].Span)
+	require.Equal(t, Span{Start: Position{2, 1, 3}, End: Position{6, 1, 7}}, tokens[2].Span)
+	require.Equal(t, Span{Start: Position{6, 1, 7}, End: Position{7, 1, 8}}, tokens[3].Span)
+}
+
+func TestScannerComments(t *testing.T) {
+	type testCase struct {
+		input    string
+		expected []TokenType
+	}
+	cases := []testCase{
+		{input: "// comment", expected: []TokenType{}},
+		{input: "/* comment */", expected: []TokenType{}},
+		{input: "1 // comment", expected: []TokenType{Integer}},
+		{input: "1 // comment\n+ 2", expected: []TokenType{Integer, Plus, Integer}},
+		{input: "1 /* comment */ + 2", expected: []TokenType{Integer, Plus, Integer}},
+		{input: "1/*comment*/+2", expected: []TokenType{Integer, Plus, Integer}},
+		{input: "1 /* multi\nline\ncomment */ + 2", expected: []TokenType{Integer, Plus, Integer}},
+		{input: "1 /* ** / * **/ + 2", expected: []TokenType{Integer, Plus, Integer}},
+		{input: "1 /* /* */ + 2", expected: []TokenType{Integer, Plus, Integer}},
+		{input: "1 / 2", expected: []TokenType{Integer, Slash, Integer}},
+		{input: `"// not a comment"`, expected: []TokenType{String}},
+	}
+
+	t.Parallel()
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			tokens, err := Scan(strings.NewReader(c.input))
+			require.NoError(t, err)
+			types := make([]TokenType, len(tokens))
+			for i, tok := range tokens {
+				types[i] = tok.Type
+			}
+			require.Equal(t, c.expected, types)
+		})
+	}
+}
+
+func TestScannerCommentSpans(t *testing.T) {
+	tokens, err := Scan(strings.NewReader("a /* one\ntwo */ +\n// three\n  b"))
+	require.NoError(t, err)
+	require.Len(t, tokens, 3)
+	require.Equal(t, Span{Start: Position{0, 1, 1}, End: Position{1, 1, 2}}, tokens[0].Span)
+	require.Equal(t, Span{Start: Position{16, 2, 8}, End: Position{17, 2, 9}}, tokens[1].Span)
+	require.Equal(t, Span{Start: Position{29, 4, 3}, End: Position{30, 4, 4}}, tokens[2].Span)
+}
+
 func TestScannerErrors(t *testing.T) {
 	cases := []string{
 		"hello | world",
@@ -144,12 +314,41 @@ func TestScannerErrors(t *testing.T) {
 		"a = 1",
 		`"hello world`,
 		"123.4.5.6",
+		"1e",
+		"1e+",
+		"0e",
+		"1__000",
+		"1_000_",
+		"1_.5",
+		"0x",
+		"0b",
+		"0x_",
+		"0b102",
+		"0o78",
+		"0b1.0",
+		"0x1.8",
+		"0xFFFFFFFFFFFFFFFF",
+		"9223372036854775808",
+		"-9223372036854775808",
+		"x + 1__0",
+		`"bad \x escape"`,
+		`"trailing \`,
+		`"\u00g9"`,
+		`"\u00"`,
+		`"\ud83d"`,
+		`"\ud83d\u0041"`,
+		`'unterminated`,
+		"`unterminated",
+		"1 /* unterminated",
+		"1 /* unterminated *",
+		"p ?.5e : 1",
 	}
 	t.Parallel()
 	for _, c := range cases {
 		t.Run(c, func(t *testing.T) {
 			_, err := Scan(strings.NewReader(c))
 			require.Error(t, err)
+			snaps.MatchSnapshot(t, err)
 		})
 	}
 }
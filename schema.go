@@ -0,0 +1,231 @@
+package pock
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Schema declares the types of the variables available to an expression. Keys
+// are variable paths, such as "user.address.city". The maps along a path, such
+// as "user.address", need not be declared: their keys are inferred from the
+// paths below them. A map that is declared keeps its declared type, and the
+// paths below it add keys to it.
+type Schema map[string]Type
+
+// Validate returns an error if a path is declared below a variable or key whose
+// declared type cannot hold it, such as "d.k" below a dict, a list or an
+// integer "d". Check ignores such paths, and uses the declared type instead.
+func (s Schema) Validate() error {
+	_, conflicts := s.root()
+	if len(conflicts) > 0 {
+		return fmt.Errorf("invalid schema: %q conflicts with the type of a map above it", conflicts[0])
+	}
+	return nil
+}
+
+// root returns the schema as the type of a map whose keys are the variables,
+// and the paths that conflict with the declared type of a map above them.
+func (s Schema) root() (Type, []string) {
+	paths := make([]string, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	fields := make(map[string]Type, len(paths))
+	var conflicts []string
+	for _, path := range paths {
+		names := strings.Split(path, ".")
+		if len(names) == 1 {
+			fields[path] = s[path]
+			continue
+		}
+		t, ok := fields[names[0]]
+		if !ok {
+			t = MapOf(nil)
+		}
+		if t, ok = withPath(t, names[1:], s[path]); !ok {
+			conflicts = append(conflicts, path)
+			continue
+		}
+		fields[names[0]] = t
+	}
+	return MapOf(fields), conflicts
+}
+
+// withPath returns a copy of t in which the key at the end of names has type
+// leaf. Optional and missing maps stay so. It returns false if t or a map
+// along names is not a map with declared keys.
+func withPath(t Type, names []string, leaf Type) (Type, bool) {
+	switch {
+	case t.Kind == OptionalType || t.Kind == MissingType:
+		elem, ok := withPath(t.elem(), names, leaf)
+		t.Elem = &elem
+		return t, ok
+	case t.Kind != MapType || t.Fields == nil:
+		return t, false
+	}
+	fields := maps.Clone(t.Fields)
+	if len(names) == 1 {
+		fields[names[0]] = leaf
+	} else {
+		child, ok := fields[names[0]]
+		if !ok {
+			child = MapOf(nil)
+		}
+		if fields[names[0]], ok = withPath(child, names[1:], leaf); !ok {
+			return t, false
+		}
+	}
+	t.Fields = fields
+	return t, true
+}
+
+// InferSchema returns a schema describing the states in samples. A variable
+// that is null in some of the samples is optional, a variable that is missing
+// from some of the samples may be missing, a variable that is an integer in
+// some samples and a decimal in others is a decimal, and a variable whose
+// values have otherwise different types in different samples is of type any.
+// Samples are converted as Interpreter.LoadState does, so that the schema
+// describes the values seen by expressions. JSON samples should be decoded with
+// json.Decoder.UseNumber, or else every number is a decimal.
+func InferSchema(samples ...map[string]any) (Schema, error) {
+	var root Type
+	for i, sample := range samples {
+		env, err := NewMapEnv(sample)
+		if err != nil {
+			return nil, err
+		}
+		t, err := typeOf(MapValue(env))
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			root = t
+		} else {
+			root = mergeTypes(root, t)
+		}
+	}
+
+	schema := Schema{}
+	for name, t := range root.Fields {
+		if strings.Contains(name, ".") {
+			return nil, fmt.Errorf("invalid variable name: %q", name)
+		}
+		schema.flatten(name, t)
+	}
+	return schema, nil
+}
+
+// flatten adds t to the schema at path, adding the keys of maps as paths of
+// their own so that the schema can be edited one path at a time.
+func (s Schema) flatten(path string, t Type) {
+	if t.Kind != MapType || t.Fields == nil || len(t.Fields) == 0 {
+		s[path] = t
+		return
+	}
+	for name := range t.Fields {
+		if strings.Contains(name, ".") {
+			s[path] = t
+			return
+		}
+	}
+	for name, field := range t.Fields {
+		s.flatten(path+"."+name, field)
+	}
+}
+
+// typeOf returns the type of val. The element type of an empty list is left
+// nil, to be filled in by mergeTypes. It returns an error if val, or a value in
+// it, is implemented outside the package.
+func typeOf(val Value) (Type, error) {
+	switch val := val.(type) {
+	case BoolValue:
+		return Type{Kind: BooleanType}, nil
+	case IntValue:
+		return Type{Kind: IntegerType}, nil
+	case DecimalValue:
+		return Type{Kind: DecimalType}, nil
+	case StringValue:
+		return Type{Kind: StringType}, nil
+	case NullValue:
+		return Type{Kind: NullType}, nil
+	case ListValue:
+		if len(val) == 0 {
+			return Type{Kind: ListType}, nil
+		}
+		elem, err := typeOf(val[0])
+		if err != nil {
+			return Type{}, err
+		}
+		for _, v := range val[1:] {
+			t, err := typeOf(v)
+			if err != nil {
+				return Type{}, err
+			}
+			elem = mergeTypes(elem, t)
+		}
+		return ListOf(elem), nil
+	case MapValue:
+		fields := make(map[string]Type, len(val))
+		for k, v := range val {
+			t, err := typeOf(v)
+			if err != nil {
+				return Type{}, err
+			}
+			fields[k] = t
+		}
+		return MapOf(fields), nil
+	}
+	return Type{}, fmt.Errorf("cannot infer the type of %s", typeName(val))
+}
+
+// mergeTypes returns a type for values observed to be of type a and of type
+// b. Unlike joinTypes, it merges the keys of maps, marking the keys absent
+// from one of them as missing.
+func mergeTypes(a, b Type) Type {
+	switch {
+	case a.Kind == MissingType || b.Kind == MissingType:
+		return MissingOf(mergeTypes(present(a), present(b)))
+	case a.Kind == AnyType || b.Kind == AnyType:
+		return Type{Kind: AnyType}
+	case reflect.DeepEqual(a, b):
+		return a
+	case a.isNumber() && b.isNumber():
+		// As in joinTypes, integers are accepted wherever decimals are.
+		return Type{Kind: DecimalType}
+	case a.Kind == NullType:
+		return OptionalOf(b)
+	case b.Kind == NullType:
+		return OptionalOf(a)
+	case a.Kind == OptionalType || b.Kind == OptionalType:
+		return OptionalOf(mergeTypes(nonNull(a), nonNull(b)))
+	case a.Kind == ListType && b.Kind == ListType:
+		if a.Elem == nil {
+			return b
+		}
+		if b.Elem == nil {
+			return a
+		}
+		return ListOf(mergeTypes(*a.Elem, *b.Elem))
+	case a.Kind == MapType && b.Kind == MapType:
+		fields := maps.Clone(a.Fields)
+		for k, t := range b.Fields {
+			if u, ok := fields[k]; ok {
+				fields[k] = mergeTypes(u, t)
+			} else {
+				fields[k] = MissingOf(t)
+			}
+		}
+		for k, t := range a.Fields {
+			if _, ok := b.Fields[k]; !ok {
+				fields[k] = MissingOf(t)
+			}
+		}
+		return MapOf(fields)
+	}
+	return Type{Kind: AnyType}
+}
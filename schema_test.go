@@ -0,0 +1,220 @@
+package pock
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferSchema(t *testing.T) {
+	schema, err := InferSchema(
+		map[string]any{
+			"age":      42,
+			"score":    1.5,
+			"nickname": nil,
+			"tags":     []any{},
+			"mixed":    []any{1, "one"},
+			"user": map[string]any{
+				"name":    "Ada",
+				"address": map[string]any{"city": "London"},
+				"orders":  []any{map[string]any{"total": 1.5}},
+				"extra":   map[string]any{},
+				"headers": map[string]any{"content.type": "json"},
+			},
+		},
+		map[string]any{
+			"age":      43,
+			"score":    2,
+			"nickname": "Bob",
+			"tags":     []string{"vip"},
+			"mixed":    []any{},
+			"premium":  true,
+			"user": map[string]any{
+				"name":    "Bob",
+				"address": nil,
+				"orders":  []any{map[string]any{"total": 2.5, "note": "gift"}},
+				"extra":   map[string]any{},
+				"headers": map[string]any{"content.type": "json"},
+			},
+		},
+	)
+	require.NoError(t, err)
+
+	actual := make(map[string]string, len(schema))
+	for path, typ := range schema {
+		actual[path] = typ.String()
+	}
+	require.Equal(t, map[string]string{
+		"age":          "integer",
+		"score":        "decimal",
+		"nickname":     "string?",
+		"tags":         "list[string]",
+		"mixed":        "list[any]",
+		"premium":      "boolean | missing",
+		"user.name":    "string",
+		"user.address": "map{city: string}?",
+		"user.orders":  "list[map{note: string | missing, total: decimal}]",
+		"user.extra":   "map{}",
+		"user.headers": `map{"content.type": string}`,
+	}, actual)
+}
+
+func TestInferSchemaCheck(t *testing.T) {
+	schema, err := InferSchema(
+		map[string]any{"user": map[string]any{"name": "Ada", "manager": nil}},
+		map[string]any{"user": map[string]any{"name": "Bob", "manager": map[string]any{"name": "Ada"}}},
+	)
+	require.NoError(t, err)
+
+	p, err := Compile(`user.manager?.name ?? user.name`)
+	require.NoError(t, err)
+	typ, diags := p.Check(schema)
+	require.Empty(t, diags)
+	require.Equal(t, "string", typ.String())
+
+	p, err = Compile(`user.manager.name`)
+	require.NoError(t, err)
+	_, diags = p.Check(schema)
+	require.Len(t, diags, 1)
+	require.Equal(t, NotAMap, diags[0].Kind)
+}
+
+func TestInferSchemaMissing(t *testing.T) {
+	schema, err := InferSchema(
+		map[string]any{"user": map[string]any{"name": "Ada", "email": "ada@example.com"}},
+		map[string]any{"user": map[string]any{"name": "Bob"}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "string | missing", schema["user.email"].String())
+
+	p, err := Compile(`user.email`)
+	require.NoError(t, err)
+	_, diags := p.Check(schema)
+	require.Len(t, diags, 1)
+	require.Equal(t, UnknownKey, diags[0].Kind)
+	_, err = p.Run(MapEnv{"user": MapValue{"name": StringValue("Bob")}})
+	var runtimeErr *RuntimeError
+	require.ErrorAs(t, err, &runtimeErr)
+	require.Equal(t, UnknownKey, runtimeErr.Kind)
+
+	for _, input := range []string{`user.email ?? user.name`, `user?.email ?? user.name`} {
+		p, err := Compile(input)
+		require.NoError(t, err)
+		typ, diags := p.Check(schema)
+		require.Empty(t, diags)
+		require.Equal(t, "string", typ.String())
+	}
+}
+
+func TestInferSchemaNumbers(t *testing.T) {
+	var sample map[string]any
+	dec := json.NewDecoder(strings.NewReader(`{"user": {"age": 30, "score": 1.5}, "xs": [1, 2], "i": 1}`))
+	dec.UseNumber()
+	require.NoError(t, dec.Decode(&sample))
+
+	schema, err := InferSchema(sample)
+	require.NoError(t, err)
+	require.Equal(t, "integer", schema["user.age"].String())
+	require.Equal(t, "decimal", schema["user.score"].String())
+	require.Equal(t, "list[integer]", schema["xs"].String())
+
+	p, err := Compile(`xs[i] + round(user.score, i) + user.age`)
+	require.NoError(t, err)
+	_, diags := p.Check(schema)
+	require.Empty(t, diags)
+}
+
+func TestInferSchemaMixedNumbers(t *testing.T) {
+	schema, err := InferSchema(
+		map[string]any{"price": 10, "xs": []any{1, 2.5}, "ys": []any{1}},
+		map[string]any{"price": 9.99, "xs": []any{}, "ys": []any{0.5}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "decimal", schema["price"].String())
+	require.Equal(t, "list[decimal]", schema["xs"].String())
+	require.Equal(t, "list[decimal]", schema["ys"].String())
+
+	p, err := Compile(`price * 2 + xs[0] + ys[0]`)
+	require.NoError(t, err)
+	typ, diags := p.Check(schema)
+	require.Empty(t, diags)
+	require.Equal(t, "decimal", typ.String())
+}
+
+func TestInferSchemaError(t *testing.T) {
+	_, err := InferSchema(map[string]any{"bad": func() {}})
+	require.Error(t, err)
+	_, err = InferSchema(map[string]any{"a.b": 1})
+	require.Error(t, err)
+	_, err = InferSchema(map[string]any{"custom": map[string]any{"a": []any{customValue{}}}})
+	require.ErrorContains(t, err, "pock.customValue")
+}
+
+func TestParseType(t *testing.T) {
+	cases := []string{
+		"any",
+		"boolean",
+		"integer",
+		"decimal",
+		"string",
+		"null",
+		"string?",
+		"list[integer]",
+		"list[integer?]?",
+		"map[decimal]",
+		"map{}",
+		"map{a: integer, b: list[map{c: string?}]}?",
+		"string | missing",
+		"map{a: integer? | missing}? | missing",
+		`map{"": null, "a b": integer, "x\"y": string}`,
+	}
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			typ, err := ParseType(c)
+			require.NoError(t, err)
+			require.Equal(t, c, typ.String())
+		})
+	}
+
+	typ, err := ParseType(" map{ a : integer ,b:string } ")
+	require.NoError(t, err)
+	require.Equal(t, MapOf(map[string]Type{"a": {Kind: IntegerType}, "b": {Kind: StringType}}), typ)
+}
+
+func TestParseTypeError(t *testing.T) {
+	cases := []string{
+		"",
+		"int",
+		"invalid",
+		"list[integer",
+		"list[]",
+		"map{a integer}",
+		"map{a: integer,}",
+		`map{"a: integer}`,
+		"integer??",
+		"integer | null",
+		"integer | missing?",
+		"integer string",
+	}
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			_, err := ParseType(c)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestSchemaJSON(t *testing.T) {
+	buf, err := json.Marshal(testSchema)
+	require.NoError(t, err)
+
+	var schema Schema
+	require.NoError(t, json.Unmarshal(buf, &schema))
+	require.Equal(t, testSchema, schema)
+
+	err = json.Unmarshal([]byte(`{"a": "number"}`), &schema)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "number"))
+}
@@ -0,0 +1,378 @@
+package pock
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type TypeKind int
+
+const (
+	// The type of an expression that has an error
+	InvalidType TypeKind = iota
+
+	// The type cannot be known statically, and every operation is allowed
+	AnyType
+
+	// Primitives
+	BooleanType
+	IntegerType
+	DecimalType
+	StringType
+	NullType
+
+	// Collections
+	ListType
+	MapType
+
+	// Either Elem or null
+	OptionalType
+
+	// Either Elem or missing, for variables and keys absent from some states
+	MissingType
+)
+
+func (k TypeKind) String() string {
+	switch k {
+	case InvalidType:
+		return "invalid"
+	case AnyType:
+		return "any"
+	case BooleanType:
+		return "boolean"
+	case IntegerType:
+		return "integer"
+	case DecimalType:
+		return "decimal"
+	case StringType:
+		return "string"
+	case NullType:
+		return "null"
+	case ListType:
+		return "list"
+	case MapType:
+		return "map"
+	case OptionalType:
+		return "optional"
+	case MissingType:
+		return "missing"
+	}
+	return "unknown"
+}
+
+func (k TypeKind) GoString() string {
+	return k.String()
+}
+
+// Type is the static type of an expression. Elem is the type of the elements
+// of a list, the type of the values of a map without Fields, or the type of an
+// optional or missing value when it is present. Fields holds the keys of a map and the
+// types of their values; a map without Fields may have any key.
+type Type struct {
+	Kind   TypeKind
+	Elem   *Type
+	Fields map[string]Type
+}
+
+// ListOf returns the type of lists of elem.
+func ListOf(elem Type) Type {
+	return Type{Kind: ListType, Elem: &elem}
+}
+
+// MapOf returns the type of maps with the given keys.
+func MapOf(fields map[string]Type) Type {
+	if fields == nil {
+		fields = map[string]Type{}
+	}
+	return Type{Kind: MapType, Fields: fields}
+}
+
+// DictOf returns the type of maps with any key and values of type elem.
+func DictOf(elem Type) Type {
+	return Type{Kind: MapType, Elem: &elem}
+}
+
+// OptionalOf returns the type of values of type t or null.
+func OptionalOf(t Type) Type {
+	switch t.Kind {
+	case AnyType, NullType, OptionalType:
+		return t
+	case MissingType:
+		return MissingOf(OptionalOf(t.elem()))
+	}
+	return Type{Kind: OptionalType, Elem: &t}
+}
+
+// MissingOf returns the type of a variable or key of type t that may be
+// missing. Unlike an optional value, a missing value cannot be read: reading it
+// fails unless it is replaced with `??` or accessed with `?.`.
+func MissingOf(t Type) Type {
+	if t.Kind == MissingType {
+		return t
+	}
+	return Type{Kind: MissingType, Elem: &t}
+}
+
+func (t Type) String() string {
+	switch t.Kind {
+	case ListType:
+		return fmt.Sprintf("list[%s]", t.elem())
+	case MapType:
+		if t.Fields == nil {
+			return fmt.Sprintf("map[%s]", t.elem())
+		}
+		keys := make([]string, 0, len(t.Fields))
+		for k := range t.Fields {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		fields := make([]string, len(keys))
+		for i, k := range keys {
+			fields[i] = fmt.Sprintf("%s: %s", typeKey(k), t.Fields[k])
+		}
+		return fmt.Sprintf("map{%s}", strings.Join(fields, ", "))
+	case OptionalType:
+		return t.elem().String() + "?"
+	case MissingType:
+		return t.elem().String() + " | missing"
+	}
+	return t.Kind.String()
+}
+
+// elem returns Elem, or AnyType if Elem is nil.
+func (t Type) elem() Type {
+	if t.Elem == nil {
+		return Type{Kind: AnyType}
+	}
+	return *t.Elem
+}
+
+// alternatives returns the types a value of type t can have at runtime,
+// splitting optional types into their element type and null.
+func (t Type) alternatives() []Type {
+	if t.Kind == OptionalType {
+		return []Type{t.elem(), {Kind: NullType}}
+	}
+	return []Type{t}
+}
+
+// isNumber reports whether t is integer or decimal.
+func (t Type) isNumber() bool {
+	return t.Kind == IntegerType || t.Kind == DecimalType
+}
+
+// joinTypes returns a type for values that may be of type a or of type b.
+// Integers and decimals join to DecimalType, as integers are accepted wherever
+// decimals are. Types that have nothing else in common join to AnyType.
+func joinTypes(a, b Type) Type {
+	switch {
+	case a.Kind == InvalidType || b.Kind == InvalidType:
+		return Type{Kind: InvalidType}
+	case a.Kind == AnyType || b.Kind == AnyType:
+		return Type{Kind: AnyType}
+	case reflect.DeepEqual(a, b):
+		return a
+	case a.isNumber() && b.isNumber():
+		return Type{Kind: DecimalType}
+	case a.Kind == NullType:
+		return OptionalOf(b)
+	case b.Kind == NullType:
+		return OptionalOf(a)
+	case a.Kind == OptionalType || b.Kind == OptionalType:
+		return OptionalOf(joinTypes(nonNull(a), nonNull(b)))
+	case a.Kind == ListType && b.Kind == ListType:
+		return ListOf(joinTypes(a.elem(), b.elem()))
+	case a.Kind == MapType && b.Kind == MapType:
+		return DictOf(Type{Kind: AnyType})
+	}
+	return Type{Kind: AnyType}
+}
+
+// present returns the type of t when it is not missing.
+func present(t Type) Type {
+	if t.Kind == MissingType {
+		return t.elem()
+	}
+	return t
+}
+
+// nonNull returns the type of the values of type t that are not null.
+func nonNull(t Type) Type {
+	if t.Kind == OptionalType {
+		return t.elem()
+	}
+	return t
+}
+
+// typeKey returns k as written in the string form of a map type, quoted
+// unless it is a valid identifier.
+func typeKey(k string) string {
+	if k == "" || strings.ContainsFunc(k, func(r rune) bool { return !isIdent(r) }) {
+		return strconv.Quote(k)
+	}
+	return k
+}
+
+func (t Type) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *Type) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+	*t, err = ParseType(s)
+	return err
+}
+
+// ParseType parses the string form of a type, as returned by Type.String.
+func ParseType(s string) (Type, error) {
+	p := typeParser{src: s}
+	t, err := p.parseType()
+	if err != nil {
+		return Type{}, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return Type{}, p.errorf("expected end of type")
+	}
+	return t, nil
+}
+
+type typeParser struct {
+	src string
+	pos int
+}
+
+func (p *typeParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid type %q at offset %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *typeParser) skipSpace() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// match consumes prefix if the rest of the source starts with it.
+func (p *typeParser) match(prefix string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (p *typeParser) expect(prefix string) error {
+	if !p.match(prefix) {
+		return p.errorf("expected `%s`", prefix)
+	}
+	return nil
+}
+
+func (p *typeParser) parseType() (Type, error) {
+	t, err := p.parseBase()
+	if err != nil {
+		return Type{}, err
+	}
+	if p.match("?") {
+		t = OptionalOf(t)
+	}
+	if p.match("|") {
+		if err := p.expect("missing"); err != nil {
+			return Type{}, err
+		}
+		t = MissingOf(t)
+	}
+	return t, nil
+}
+
+func (p *typeParser) parseBase() (Type, error) {
+	switch {
+	case p.match("list["):
+		elem, err := p.parseType()
+		if err != nil {
+			return Type{}, err
+		}
+		return ListOf(elem), p.expect("]")
+	case p.match("map["):
+		elem, err := p.parseType()
+		if err != nil {
+			return Type{}, err
+		}
+		return DictOf(elem), p.expect("]")
+	case p.match("map{"):
+		return p.parseFields()
+	}
+
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] >= 'a' && p.src[p.pos] <= 'z' {
+		p.pos++
+	}
+	for _, kind := range []TypeKind{AnyType, BooleanType, IntegerType, DecimalType, StringType, NullType} {
+		if p.src[start:p.pos] == kind.String() {
+			return Type{Kind: kind}, nil
+		}
+	}
+	p.pos = start
+	return Type{}, p.errorf("unknown type")
+}
+
+func (p *typeParser) parseFields() (Type, error) {
+	fields := map[string]Type{}
+	if p.match("}") {
+		return MapOf(fields), nil
+	}
+	for {
+		key, err := p.parseKey()
+		if err != nil {
+			return Type{}, err
+		}
+		if err := p.expect(":"); err != nil {
+			return Type{}, err
+		}
+		fields[key], err = p.parseType()
+		if err != nil {
+			return Type{}, err
+		}
+		if p.match("}") {
+			return MapOf(fields), nil
+		}
+		if err := p.expect(","); err != nil {
+			return Type{}, err
+		}
+	}
+}
+
+func (p *typeParser) parseKey() (string, error) {
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == '"' {
+		quoted, err := strconv.QuotedPrefix(p.src[p.pos:])
+		if err != nil {
+			return "", p.errorf("invalid key")
+		}
+		p.pos += len(quoted)
+		return strconv.Unquote(quoted)
+	}
+	start := p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !isIdent(r) {
+			break
+		}
+		p.pos += size
+	}
+	if start == p.pos {
+		return "", p.errorf("expected key")
+	}
+	return p.src[start:p.pos], nil
+}
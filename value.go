@@ -6,6 +6,8 @@ type Value interface {
 	GetString() (string, bool)
 	GetBool() (bool, bool)
 	GetNull() (interface{}, bool)
+	GetList() ([]Value, bool)
+	GetMap() (map[string]Value, bool)
 }
 
 type IntValue int64
@@ -30,6 +32,14 @@ func (v IntValue) GetNull() (interface{}, bool) {
 	return nil, false
 }
 
+func (v IntValue) GetList() ([]Value, bool) {
+	return nil, false
+}
+
+func (v IntValue) GetMap() (map[string]Value, bool) {
+	return nil, false
+}
+
 type DecimalValue float64
 
 func (v DecimalValue) GetInteger() (int64, bool) {
@@ -52,6 +62,14 @@ func (v DecimalValue) GetNull() (interface{}, bool) {
 	return nil, false
 }
 
+func (v DecimalValue) GetList() ([]Value, bool) {
+	return nil, false
+}
+
+func (v DecimalValue) GetMap() (map[string]Value, bool) {
+	return nil, false
+}
+
 type StringValue string
 
 func (v StringValue) GetInteger() (int64, bool) {
@@ -74,6 +92,14 @@ func (v StringValue) GetNull() (interface{}, bool) {
 	return nil, false
 }
 
+func (v StringValue) GetList() ([]Value, bool) {
+	return nil, false
+}
+
+func (v StringValue) GetMap() (map[string]Value, bool) {
+	return nil, false
+}
+
 type BoolValue bool
 
 func (v BoolValue) GetInteger() (int64, bool) {
@@ -96,6 +122,14 @@ func (v BoolValue) GetNull() (interface{}, bool) {
 	return nil, false
 }
 
+func (v BoolValue) GetList() ([]Value, bool) {
+	return nil, false
+}
+
+func (v BoolValue) GetMap() (map[string]Value, bool) {
+	return nil, false
+}
+
 type NullValue struct{}
 
 func (v NullValue) GetInteger() (int64, bool) {
@@ -118,4 +152,76 @@ func (v NullValue) GetNull() (interface{}, bool) {
 	return nil, true
 }
 
+func (v NullValue) GetList() ([]Value, bool) {
+	return nil, false
+}
+
+func (v NullValue) GetMap() (map[string]Value, bool) {
+	return nil, false
+}
+
+func (v NullValue) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
 var null = NullValue{}
+
+type ListValue []Value
+
+func (v ListValue) GetInteger() (int64, bool) {
+	return 0, false
+}
+
+func (v ListValue) GetDecimal() (float64, bool) {
+	return 0.0, false
+}
+
+func (v ListValue) GetString() (string, bool) {
+	return "", false
+}
+
+func (v ListValue) GetBool() (bool, bool) {
+	return false, false
+}
+
+func (v ListValue) GetNull() (interface{}, bool) {
+	return nil, false
+}
+
+func (v ListValue) GetList() ([]Value, bool) {
+	return v, true
+}
+
+func (v ListValue) GetMap() (map[string]Value, bool) {
+	return nil, false
+}
+
+type MapValue map[string]Value
+
+func (v MapValue) GetInteger() (int64, bool) {
+	return 0, false
+}
+
+func (v MapValue) GetDecimal() (float64, bool) {
+	return 0.0, false
+}
+
+func (v MapValue) GetString() (string, bool) {
+	return "", false
+}
+
+func (v MapValue) GetBool() (bool, bool) {
+	return false, false
+}
+
+func (v MapValue) GetNull() (interface{}, bool) {
+	return nil, false
+}
+
+func (v MapValue) GetList() ([]Value, bool) {
+	return nil, false
+}
+
+func (v MapValue) GetMap() (map[string]Value, bool) {
+	return v, true
+}
@@ -0,0 +1,237 @@
+package pock
+
+import (
+	"context"
+	"fmt"
+)
+
+// try is an opTry being run: the guard catching errors, and the height of the
+// stack to restore when it does.
+type try struct {
+	guard  int
+	height int
+}
+
+// run runs the bytecode against env, layered over the variables of s, as
+// s.EvaluateEnv would evaluate the expression it was compiled from. The VM does
+// not recurse, so only the steps of the limits of s apply, each instruction
+// counting as a step.
+func (b *bytecode) run(ctx context.Context, s *Interpreter, env Env) (Value, error) {
+	if err := interrupted(ctx, b.spans[0]); err != nil {
+		return nil, err
+	}
+	env = s.layer(env)
+	stack := make([]Value, 0, b.maxStack)
+	// Variables are looked up the first time their slot is loaded, so that
+	// expressions that are not evaluated do not fail on missing variables.
+	slots := make([]Value, len(b.slots))
+	var tries []try
+
+	steps := 0
+	for pc := 0; pc < len(b.code); pc++ {
+		in := b.code[pc]
+		var err error
+		steps++
+		if s.limits.maxSteps > 0 && steps > s.limits.maxSteps {
+			return nil, stepError(b.spans[pc], s.limits.maxSteps)
+		}
+		if steps%contextCheckInterval == 0 {
+			if err := interrupted(ctx, b.spans[pc]); err != nil {
+				return nil, err
+			}
+		}
+
+		switch in.op {
+		case opConst:
+			stack = append(stack, b.constants[in.arg])
+		case opLoad:
+			val := slots[in.arg]
+			if val == nil {
+				val, err = lookup(env, b.slots[in.arg], b.spans[pc])
+				if err != nil {
+					break
+				}
+				slots[in.arg] = val
+			}
+			stack = append(stack, val)
+		case opBinary:
+			n := len(stack)
+			var val Value
+			val, err = binary(s, TokenType(in.arg), b.spans[pc], stack[n-2], stack[n-1])
+			stack = append(stack[:n-2], val)
+		case opUnary:
+			n := len(stack)
+			stack[n-1], err = s.unary(TokenType(in.arg), b.spans[pc], stack[n-1])
+		case opIndex:
+			n := len(stack)
+			var val Value
+			val, err = indexValue(b.spans[pc], stack[n-2], stack[n-1])
+			if err != nil && in.arg == 1 {
+				val, err = null, nil
+			}
+			stack = append(stack[:n-2], val)
+		case opCall:
+			site := b.calls[in.arg]
+			if !site.found {
+				err = runtimeErrorf(UnknownFunction, b.spans[pc], "unknown function '%s'", site.name)
+				break
+			}
+			n := len(stack) - site.argc
+			args := make([]Value, site.argc)
+			copy(args, stack[n:])
+			var val Value
+			val, err = s.call(site.name, b.spans[pc], site.fn, args)
+			stack = append(stack[:n], val)
+		case opList:
+			n := len(stack) - int(in.arg)
+			list := make(ListValue, in.arg)
+			copy(list, stack[n:])
+			stack = append(stack[:n], list)
+		case opMap:
+			keys := b.keys[in.arg]
+			n := len(stack) - len(keys)
+			m := make(MapValue, len(keys))
+			for i, key := range keys {
+				m[key] = stack[n+i]
+			}
+			stack = append(stack[:n], m)
+		case opJump:
+			pc = int(in.arg) - 1
+		case opJumpIfFalse:
+			cond := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			c, ok := cond.(BoolValue)
+			if !ok {
+				err = typeError(b.spans[pc], "`?:` condition must be boolean", cond)
+				break
+			}
+			if !c {
+				pc = int(in.arg) - 1
+			}
+		case opShortCircuit:
+			left := stack[len(stack)-1]
+			// The operator is the argument of the opCheckBool that ends the
+			// right operand, just before the jump target.
+			op := b.code[in.arg-1].arg
+			l, ok := left.(BoolValue)
+			if !ok {
+				err = typeError(b.spans[pc], logicalMessage(TokenType(op)), left)
+				break
+			}
+			if (TokenType(op) == Or && bool(l)) || (TokenType(op) == And && !bool(l)) {
+				pc = int(in.arg) - 1
+				break
+			}
+			stack = stack[:len(stack)-1]
+		case opCheckBool:
+			right := stack[len(stack)-1]
+			if _, ok := right.(BoolValue); !ok {
+				// The left operand was popped, but only its type, boolean,
+				// appears in the error.
+				err = typeError(b.spans[pc], logicalMessage(TokenType(in.arg)), BoolValue(false), right)
+			}
+		case opJumpIfNotNull:
+			if _, ok := stack[len(stack)-1].(NullValue); !ok {
+				pc = int(in.arg) - 1
+				break
+			}
+			stack = stack[:len(stack)-1]
+		case opJumpIfNull:
+			if _, ok := stack[len(stack)-1].(NullValue); ok {
+				pc = int(in.arg) - 1
+			}
+		case opTry:
+			tries = append(tries, try{guard: int(in.arg), height: len(stack)})
+		case opEndTry:
+			tries = tries[:len(tries)-1]
+		default:
+			panic(fmt.Sprintf("invalid opcode: %d", in.op))
+		}
+
+		if err != nil {
+			// Unwind to the innermost `??` whose left operand is missing the
+			// value that caused the error.
+			for err != nil && len(tries) > 0 {
+				t := tries[len(tries)-1]
+				tries = tries[:len(tries)-1]
+				g := b.guards[t.guard]
+				if isMissing(g.expr, err) {
+					stack = stack[:t.height]
+					pc = g.target - 1
+					err = nil
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stack[0], nil
+}
+
+// binary applies the binary operator op to left and right, handling operands
+// of the same numeric type without going through the type assertions of
+// Interpreter.binary.
+func binary(s *Interpreter, op TokenType, span Span, left, right Value) (Value, error) {
+	switch l := left.(type) {
+	case IntValue:
+		r, ok := right.(IntValue)
+		if !ok {
+			break
+		}
+		switch op {
+		case Lt:
+			return BoolValue(l < r), nil
+		case Lte:
+			return BoolValue(l <= r), nil
+		case Gt:
+			return BoolValue(l > r), nil
+		case Gte:
+			return BoolValue(l >= r), nil
+		case Eq:
+			return BoolValue(l == r), nil
+		case Neq:
+			return BoolValue(l != r), nil
+		case Plus:
+			if r, ok := addInt(int64(l), int64(r)); ok {
+				return IntValue(r), nil
+			}
+		case Minus:
+			if r, ok := subInt(int64(l), int64(r)); ok {
+				return IntValue(r), nil
+			}
+		case Star:
+			if r, ok := mulInt(int64(l), int64(r)); ok {
+				return IntValue(r), nil
+			}
+		}
+	case DecimalValue:
+		r, ok := right.(DecimalValue)
+		if !ok {
+			break
+		}
+		switch op {
+		case Lt:
+			return BoolValue(l < r), nil
+		case Lte:
+			return BoolValue(l <= r), nil
+		case Gt:
+			return BoolValue(l > r), nil
+		case Gte:
+			return BoolValue(l >= r), nil
+		case Eq:
+			return BoolValue(l == r), nil
+		case Neq:
+			return BoolValue(l != r), nil
+		case Plus:
+			return l + r, nil
+		case Minus:
+			return l - r, nil
+		case Star:
+			return l * r, nil
+		case Slash:
+			return l / r, nil
+		}
+	}
+	return s.binary(op, span, left, right)
+}
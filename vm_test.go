@@ -0,0 +1,164 @@
+package pock
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func compileTest(t testing.TB, input string, state map[string]any, opts ...Option) (*Interpreter, Expr, *bytecode) {
+	tokens, err := Scan(strings.NewReader(input))
+	require.NoError(t, err)
+	expr, err := Parse(tokens)
+	require.NoError(t, err)
+	i, err := NewInterpreterWithState(state, opts...)
+	require.NoError(t, err)
+	return i, expr, compileBytecode(expr, i.functions)
+}
+
+func TestVM(t *testing.T) {
+	t.Parallel()
+	for _, c := range interpreterCases {
+		t.Run(c.input, func(t *testing.T) {
+			i, _, code := compileTest(t, c.input, c.state)
+			val, err := code.run(context.Background(), i, nil)
+			require.NoError(t, err)
+			require.EqualValues(t, c.expected, val)
+		})
+	}
+}
+
+func TestVMError(t *testing.T) {
+	t.Parallel()
+	for _, c := range interpreterErrorCases {
+		t.Run(c.input, func(t *testing.T) {
+			i, expr, code := compileTest(t, c.input, c.state)
+			_, expected := i.Evaluate(expr)
+			_, err := code.run(context.Background(), i, nil)
+			require.Error(t, err)
+			require.Equal(t, expected, err)
+		})
+	}
+}
+
+// TestVMAgreesWithEvaluate checks expressions exercising the control flow of
+// the VM against the tree-walking interpreter.
+func TestVMAgreesWithEvaluate(t *testing.T) {
+	state := map[string]any{
+		"max":  math.MaxInt64,
+		"xs":   []any{1, 2.5, "three", nil},
+		"user": map[string]any{"name": "Ada", "manager": nil},
+	}
+	inputs := []string{
+		"xs[0] + xs[0] * xs[1] - xs[0]",
+		"max + 1",
+		"max + 1 ?? 0",
+		"missing ?? (other ?? 3)",
+		"(missing ?? xs)[9] ?? 4",
+		"(xs[9] ?? xs[8]) ?? 5",
+		"[missing ?? 1, user.manager?.name ?? user.name, {\"a\": xs[9] ?? 6}]",
+		"true ? (missing ?? 1) : missing",
+		"false || (missing ?? true) && !false",
+		"true && xs[2] ?? true",
+		"user.manager.name ?? 1",
+		"len(missing ?? xs) + len(missing)",
+		"unknown(missing)",
+		"1 / 0 ?? 1",
+		"xs[3] ?? (xs[3] ?? (xs[3] ?? 7))",
+		"(-xs[1] * 2 > 4.0) == (xs[2] in \"three\")",
+		"round(xs[1]) ** 2 % 3",
+		"missing?.name ?? xs[9]?.a ?? user.nope?.x",
+		"[user.manager?.name, missing?.[0], xs[missing]?.a ?? 1]",
+		"user?.manager.name.first ?? missing?.a.b[0]",
+		"user.manager?.name[missing] ?? xs?.[9][0]",
+		"(user?.manager).name ?? 8",
+	}
+	for _, opts := range [][]Option{nil, {WithOverflowPromotion()}} {
+		for _, input := range inputs {
+			t.Run(input, func(t *testing.T) {
+				i, expr, code := compileTest(t, input, state, opts...)
+				expectedVal, expectedErr := i.Evaluate(expr)
+				val, err := code.run(context.Background(), i, nil)
+				require.Equal(t, expectedErr, err)
+				require.Equal(t, expectedVal, val)
+			})
+		}
+	}
+}
+
+func TestVMSlots(t *testing.T) {
+	var calls atomic.Int32
+	env := NewLazyEnv(map[string]func() Value{
+		"user": func() Value {
+			calls.Add(1)
+			return MapValue{"age": IntValue(42)}
+		},
+	})
+
+	p, err := Compile("user.age > 18 && user.age < 65 ? user.age : missing")
+	require.NoError(t, err)
+	require.Len(t, p.code.slots, 2)
+
+	val, err := p.Run(env)
+	require.NoError(t, err)
+	require.Equal(t, IntValue(42), val)
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func BenchmarkVM(b *testing.B) {
+	type compiled struct {
+		interpreter *Interpreter
+		expr        Expr
+		code        *bytecode
+	}
+	cases := make([]compiled, len(interpreterCases))
+	for n, c := range interpreterCases {
+		i, expr, code := compileTest(b, c.input, c.state)
+		cases[n] = compiled{interpreter: i, expr: expr, code: code}
+	}
+
+	b.Run("cases/tree", func(b *testing.B) {
+		for range b.N {
+			for _, c := range cases {
+				benchmarkValue, _ = c.interpreter.Evaluate(c.expr)
+			}
+		}
+	})
+	b.Run("cases/vm", func(b *testing.B) {
+		for range b.N {
+			for _, c := range cases {
+				benchmarkValue, _ = c.code.run(context.Background(), c.interpreter, nil)
+			}
+		}
+	})
+
+	for n := range 6 {
+		count := 1 << (n * 2)
+		input := strings.Join(
+			slices.Repeat(
+				[]string{"(hello.world + 3 == 0) || (1.0 + 1 == 2.0)"},
+				count,
+			),
+			" && ",
+		)
+		state := map[string]any{"hello": map[string]any{"world": 1138}}
+		i, expr, code := compileTest(b, input, state)
+
+		b.Run(fmt.Sprintf("%d/tree", count), func(b *testing.B) {
+			for range b.N {
+				benchmarkValue, _ = i.Evaluate(expr)
+			}
+		})
+		b.Run(fmt.Sprintf("%d/vm", count), func(b *testing.B) {
+			for range b.N {
+				benchmarkValue, _ = code.run(context.Background(), i, nil)
+			}
+		})
+	}
+}